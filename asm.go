@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lc3asm-parser/assembler"
+)
+
+// assemble implements `asm [-o out.obj] file.asm`. The .sym and .lst
+// files are written next to the object file.
+func assemble(args []string) error {
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	out := fs.String("o", "", "object file to write (default: source name with .obj)")
+	sym := fs.Bool("sym", true, "write a .sym symbol table")
+	lst := fs.Bool("lst", true, "write a .lst listing")
+	strict := fs.Bool("strict", false, "only accept keywords in upper case, with BR's condition codes in lower case")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: asm [-o out.obj] [-sym=false] [-lst=false] [-strict] file.asm")
+	}
+	path := fs.Arg(0)
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	assemble := assembler.Assemble
+	if *strict {
+		assemble = assembler.AssembleStrict
+	}
+	obj, err := assemble(string(src))
+	if err != nil {
+		return prefixErrors(path, err)
+	}
+
+	if *out == "" {
+		*out = replaceExt(path, ".obj")
+	}
+
+	if err := writeFile(*out, func(w io.Writer) error {
+		_, err := obj.WriteTo(w)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if *sym {
+		if err := writeFile(replaceExt(*out, ".sym"), func(w io.Writer) error {
+			_, err := obj.Symbols.WriteTo(w)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	if *lst {
+		return writeFile(replaceExt(*out, ".lst"), func(w io.Writer) error {
+			return obj.WriteListing(w, string(src))
+		})
+	}
+
+	return nil
+}
+
+// assembleFile assembles the source at path.
+func assembleFile(path string) (*assembler.Object, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return assembleSource(path, string(src))
+}
+
+// assembleSource assembles src, reporting errors one per line as
+// path:line:column: message.
+func assembleSource(path, src string) (*assembler.Object, error) {
+	obj, err := assembler.Assemble(src)
+	if err != nil {
+		return nil, prefixErrors(path, err)
+	}
+	return obj, nil
+}
+
+// prefixErrors writes each assembler error in err on its own line as
+// path:line:column: message.
+func prefixErrors(path string, err error) error {
+	list, ok := err.(assembler.ErrorList)
+	if !ok {
+		return err
+	}
+	msgs := make([]string, len(list))
+	for i, e := range list {
+		msgs[i] = fmt.Sprintf("%s:%s", path, e)
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func replaceExt(path, ext string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
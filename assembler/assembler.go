@@ -0,0 +1,360 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+
+	"lc3asm-parser/ast"
+	"lc3asm-parser/lexer"
+	"lc3asm-parser/parser"
+	"lc3asm-parser/token"
+)
+
+// Opcodes occupy the top four bits of every instruction word.
+const (
+	opBR   = 0x0
+	opADD  = 0x1
+	opLD   = 0x2
+	opST   = 0x3
+	opJSR  = 0x4
+	opAND  = 0x5
+	opLDR  = 0x6
+	opSTR  = 0x7
+	opRTI  = 0x8
+	opNOT  = 0x9
+	opLDI  = 0xA
+	opSTI  = 0xB
+	opJMP  = 0xC
+	opLEA  = 0xE
+	opTRAP = 0xF
+)
+
+// Error is a problem found while assembling, located at Pos.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorList is returned by Assemble when parsing or assembly fails.
+type ErrorList []Error
+
+func (el ErrorList) Error() string {
+	msgs := make([]string, len(el))
+	for i, e := range el {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+type Assembler struct {
+	program *ast.Program
+	symbols *SymbolTable
+	errors  []Error
+
+	origin  uint16
+	code    []uint16
+	records []Record
+}
+
+func New(program *ast.Program) *Assembler {
+	return &Assembler{program: program, symbols: NewSymbolTable()}
+}
+
+func (a *Assembler) Errors() []Error {
+	return a.errors
+}
+
+// Assemble lexes, parses and assembles input. Parser errors stop assembly
+// early; either way the returned error is an ErrorList.
+func Assemble(input string) (*Object, error) {
+	return assembleFrom(lexer.New(input))
+}
+
+// AssembleStrict is Assemble for sources whose keywords must be written
+// in their canonical case; add or r1 are reported as errors.
+func AssembleStrict(input string) (*Object, error) {
+	return assembleFrom(lexer.NewStrict(input))
+}
+
+func assembleFrom(l *lexer.Lexer) (*Object, error) {
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		list := make(ErrorList, len(errs))
+		for i, e := range errs {
+			list[i] = Error{Pos: e.Pos, Msg: e.Msg}
+		}
+		return nil, list
+	}
+
+	a := New(program)
+	obj := a.Assemble()
+	if len(a.errors) > 0 {
+		return nil, ErrorList(a.errors)
+	}
+	return obj, nil
+}
+
+// Assemble runs both passes over the program. The object is only
+// meaningful when Errors is empty.
+func (a *Assembler) Assemble() *Object {
+	a.firstPass()
+	if len(a.errors) == 0 {
+		a.secondPass()
+	}
+
+	return &Object{Origin: a.origin, Code: a.code, Symbols: a.symbols, Records: a.records, Lines: lineTable(a.records)}
+}
+
+// firstPass assigns an address to every label.
+func (a *Assembler) firstPass() {
+	var address int
+	seenOrig := false
+
+	for _, stmt := range a.statements() {
+		switch stmt := stmt.(type) {
+		case *ast.OrigDirective:
+			if seenOrig {
+				a.errorf(stmt.Token.Pos, "multiple .ORIG directives")
+				continue
+			}
+			seenOrig = true
+			a.origin = a.unsignedField(stmt.Address.Value, 16, stmt.Address.Token.Pos, "address", "16-bit")
+			address = int(a.origin)
+			continue
+		case *ast.BeginDirective:
+			continue
+		}
+
+		if !seenOrig {
+			a.errorf(stmt.Pos(), "%s before .ORIG", describe(stmt))
+			return
+		}
+
+		if label, ok := stmt.(*ast.Label); ok {
+			if prev, ok := a.symbols.Define(label.Value, uint16(address), label.Token.Pos); !ok {
+				a.errorf(label.Token.Pos, "label %q already defined at %s", label.Value, prev.Pos)
+			}
+			continue
+		}
+
+		size := a.size(stmt)
+		if address+size > 0x10000 {
+			a.errorf(stmt.Pos(), "program extends past xFFFF")
+			return
+		}
+		address += size
+	}
+
+	if !seenOrig {
+		a.errorf(token.Position{}, "missing .ORIG directive")
+	}
+}
+
+// secondPass encodes every statement now that all labels are known.
+func (a *Assembler) secondPass() {
+	address := a.origin
+
+	for _, stmt := range a.statements() {
+		words := a.encode(stmt, address)
+		if len(words) > 0 {
+			a.records = append(a.records, Record{Statement: stmt, Address: address, Words: words})
+		}
+		a.code = append(a.code, words...)
+		address += uint16(len(words))
+	}
+}
+
+// statements returns the statements up to the first .END.
+func (a *Assembler) statements() []ast.Statement {
+	for i, stmt := range a.program.Statements {
+		if _, ok := stmt.(*ast.EndDirective); ok {
+			return a.program.Statements[:i]
+		}
+	}
+	return a.program.Statements
+}
+
+// size returns the number of words stmt occupies in memory.
+func (a *Assembler) size(stmt ast.Statement) int {
+	switch stmt := stmt.(type) {
+	case *ast.Label, *ast.OrigDirective, *ast.BeginDirective, *ast.EndDirective:
+		return 0
+	case *ast.BlkwDirective:
+		if stmt.Count.Value < 1 {
+			a.errorf(stmt.Count.Token.Pos, ".BLKW count must be positive, got %d", stmt.Count.Value)
+			return 0
+		}
+		return stmt.Count.Value
+	case *ast.StringzDirective:
+		return len(stmt.Value.Value) + 1
+	default:
+		return 1
+	}
+}
+
+func (a *Assembler) encode(stmt ast.Statement, address uint16) []uint16 {
+	switch stmt := stmt.(type) {
+	case *ast.ThreeRegisterStatement:
+		return []uint16{opcodeBits(stmt.Opcode) |
+			reg(stmt.DataRegister, 9) | reg(stmt.SourceRegisters[0], 6) | reg(stmt.SourceRegisters[1], 0)}
+	case *ast.TwoRegisterImmediate:
+		return []uint16{opcodeBits(stmt.Opcode) |
+			reg(stmt.DataRegister, 9) | reg(stmt.SourceRegister, 6) | 1<<5 |
+			a.signedField(stmt.Immediate.Value, 5, stmt.Immediate.Token.Pos, "immediate", "imm5")}
+	case *ast.TwoRegister:
+		return []uint16{opNOT<<12 | reg(stmt.DataRegister, 9) | reg(stmt.SourceRegister, 6) | 0x3F}
+	case *ast.RegisterLabelStatement:
+		offset := a.pcOffset(stmt.Label, stmt.Offset, address, 9)
+		return []uint16{opcodeBits(stmt.Opcode) | reg(stmt.Register, 9) | offset}
+	case *ast.TwoRegisterOffset:
+		return []uint16{opcodeBits(stmt.Opcode) |
+			reg(stmt.LeftRegister, 9) | reg(stmt.RightRegister, 6) |
+			a.signedField(stmt.Offset.Value, 6, stmt.Offset.Token.Pos, "offset", "offset6")}
+	case *ast.BranchStatement:
+		var cc uint16
+		if stmt.N {
+			cc |= 1 << 11
+		}
+		if stmt.Z {
+			cc |= 1 << 10
+		}
+		if stmt.P {
+			cc |= 1 << 9
+		}
+		// A bare BR is unconditional
+		if cc == 0 {
+			cc = 7 << 9
+		}
+		return []uint16{opBR<<12 | cc | a.pcOffset(stmt.Label, stmt.Offset, address, 9)}
+	case *ast.OneRegister:
+		if stmt.Opcode.Literal == "JSRR" {
+			return []uint16{opJSR<<12 | reg(stmt.Register, 6)}
+		}
+		return []uint16{opJMP<<12 | reg(stmt.Register, 6)}
+	case *ast.SubroutineStatement:
+		return []uint16{opJSR<<12 | 1<<11 | a.pcOffset(stmt.Label, stmt.Offset, address, 11)}
+	case *ast.NoOperand:
+		if stmt.Opcode.Literal == "RTI" {
+			return []uint16{opRTI << 12}
+		}
+		// RET is JMP R7
+		return []uint16{opJMP<<12 | 7<<6}
+	case *ast.TrapStatement:
+		return []uint16{opTRAP<<12 | a.unsignedField(stmt.Vector.Value, 8, stmt.Vector.Token.Pos, "trap vector", "trapvect8")}
+	case *ast.FillDirective:
+		if stmt.Label != nil {
+			sym, ok := a.resolve(stmt.Label)
+			if !ok {
+				return []uint16{0}
+			}
+			return []uint16{sym.Address}
+		}
+		return []uint16{a.wordField(stmt.Value.Value, stmt.Value.Token.Pos)}
+	case *ast.BlkwDirective:
+		return make([]uint16, stmt.Count.Value)
+	case *ast.StringzDirective:
+		words := make([]uint16, 0, len(stmt.Value.Value)+1)
+		for i := 0; i < len(stmt.Value.Value); i++ {
+			words = append(words, uint16(stmt.Value.Value[i]))
+		}
+		return append(words, 0)
+	default:
+		return nil
+	}
+}
+
+// pcOffset encodes the distance from the incremented PC to a label, or a
+// literal offset, in the low n bits.
+func (a *Assembler) pcOffset(label *ast.Label, offset *ast.IntegerLiteral, address uint16, n int) uint16 {
+	field := fmt.Sprintf("PCoffset%d", n)
+
+	if label == nil {
+		return a.signedField(offset.Value, n, offset.Token.Pos, "offset", field)
+	}
+
+	sym, ok := a.resolve(label)
+	if !ok {
+		return 0
+	}
+
+	distance := int(sym.Address) - int(address) - 1
+	return a.signedField(distance, n, label.Token.Pos, fmt.Sprintf("distance to %q from PC x%04X", label.Value, address+1), field)
+}
+
+// signedField encodes value as an n-bit two's complement field, reporting
+// an error at pos if it does not fit.
+func (a *Assembler) signedField(value, n int, pos token.Position, what, field string) uint16 {
+	min, max := -(1 << (n - 1)), 1<<(n-1)-1
+	if value < min || value > max {
+		a.errorf(pos, "%s is %d, outside the %s range [%d, %d]", what, value, field, min, max)
+	}
+	return bits(value, n)
+}
+
+// unsignedField encodes value as an n-bit unsigned field, reporting an
+// error at pos if it does not fit.
+func (a *Assembler) unsignedField(value, n int, pos token.Position, what, field string) uint16 {
+	max := 1<<n - 1
+	if value < 0 || value > max {
+		a.errorf(pos, "%s is %d, outside the %s range [0, %d]", what, value, field, max)
+	}
+	return bits(value, n)
+}
+
+// wordField encodes a .FILL value, which may be written either signed or
+// unsigned.
+func (a *Assembler) wordField(value int, pos token.Position) uint16 {
+	if value < -0x8000 || value > 0xFFFF {
+		a.errorf(pos, "value is %d, outside the 16-bit range [-32768, 65535]", value)
+	}
+	return uint16(value)
+}
+
+func (a *Assembler) resolve(label *ast.Label) (*Symbol, bool) {
+	sym, ok := a.symbols.Resolve(label.Value)
+	if !ok {
+		a.errorf(label.Token.Pos, "undefined label %q", label.Value)
+	}
+	return sym, ok
+}
+
+func (a *Assembler) errorf(pos token.Position, format string, args ...interface{}) {
+	a.errors = append(a.errors, Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+var opcodes = map[string]uint16{
+	"ADD": opADD,
+	"AND": opAND,
+	"LD":  opLD,
+	"LDI": opLDI,
+	"LEA": opLEA,
+	"ST":  opST,
+	"STI": opSTI,
+	"LDR": opLDR,
+	"STR": opSTR,
+}
+
+func opcodeBits(op *ast.Opcode) uint16 {
+	return opcodes[op.Literal] << 12
+}
+
+func reg(r *ast.Register, shift int) uint16 {
+	return uint16(r.ID&7) << shift
+}
+
+// bits truncates value to its low n bits.
+func bits(value int, n int) uint16 {
+	return uint16(value) & (1<<n - 1)
+}
+
+func describe(stmt ast.Statement) string {
+	if _, ok := stmt.(*ast.Label); ok {
+		return "label"
+	}
+	return fmt.Sprintf("%q", stmt.TokenLiteral())
+}
@@ -0,0 +1,306 @@
+package assembler
+
+import (
+	"bytes"
+	"testing"
+)
+
+const program = `	.ORIG x3000
+START	LD R0, DATA
+	LEA R1, MSG
+LOOP	ADD R0,R0,#-1
+	BRp LOOP
+	BR DONE
+	JSR SUB
+	JSRR R2
+DONE	HALT
+SUB	RET
+	RTI
+	JMP R3
+	LDR R4,R5,#-2
+	STR R4,R5,#3
+	NOT R1,R2
+	AND R1,R2,R3
+	TRAP x21
+DATA	.FILL #10
+PTR	.FILL DATA
+BUF	.BLKW 2
+MSG	.STRINGZ "Hi"
+	.END
+	ADD R0,R0,R0 ; ignored after .END
+`
+
+func TestAssemble(t *testing.T) {
+	obj := assemble(t, program)
+
+	if obj.Origin != 0x3000 {
+		t.Errorf("origin wrong. expected=x3000, got=x%04X", obj.Origin)
+	}
+
+	expected := []uint16{
+		0x200F, // LD R0, DATA
+		0xE212, // LEA R1, MSG
+		0x103F, // ADD R0,R0,#-1
+		0x03FE, // BRp LOOP
+		0x0E02, // BR DONE
+		0x4802, // JSR SUB
+		0x4080, // JSRR R2
+		0xF025, // HALT
+		0xC1C0, // RET
+		0x8000, // RTI
+		0xC0C0, // JMP R3
+		0x697E, // LDR R4,R5,#-2
+		0x7943, // STR R4,R5,#3
+		0x92BF, // NOT R1,R2
+		0x5283, // AND R1,R2,R3
+		0xF021, // TRAP x21
+		0x000A, // .FILL #10
+		0x3010, // .FILL DATA
+		0x0000, // .BLKW 2
+		0x0000,
+		'H', 'i', 0, // .STRINGZ "Hi"
+	}
+
+	if len(obj.Code) != len(expected) {
+		t.Fatalf("code length wrong. expected=%d, got=%d", len(expected), len(obj.Code))
+	}
+
+	for i, word := range expected {
+		if obj.Code[i] != word {
+			t.Errorf("code[%d] (x%04X) wrong. expected=x%04X, got=x%04X", i, 0x3000+i, word, obj.Code[i])
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	obj := assemble(t, program)
+
+	tests := []struct {
+		name    string
+		address uint16
+	}{
+		{"START", 0x3000},
+		{"LOOP", 0x3002},
+		{"DONE", 0x3007},
+		{"SUB", 0x3008},
+		{"DATA", 0x3010},
+		{"PTR", 0x3011},
+		{"BUF", 0x3012},
+		{"MSG", 0x3014},
+	}
+
+	symbols := obj.Symbols.Symbols()
+	if len(symbols) != len(tests) {
+		t.Fatalf("wrong number of symbols. expected=%d, got=%d", len(tests), len(symbols))
+	}
+
+	for i, tt := range tests {
+		if symbols[i].Name != tt.name || symbols[i].Address != tt.address {
+			t.Errorf("tests[%d] - symbol wrong. expected=%s x%04X, got=%s x%04X",
+				i, tt.name, tt.address, symbols[i].Name, symbols[i].Address)
+		}
+
+		sym, ok := obj.Symbols.Resolve(tt.name)
+		if !ok || sym.Address != tt.address {
+			t.Errorf("tests[%d] - could not resolve %s", i, tt.name)
+		}
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	obj := assemble(t, program)
+
+	lines := []struct {
+		line     int
+		expected int // Line found, or 0 for none
+		address  uint16
+	}{
+		{1, 2, 0x3000},
+		{4, 4, 0x3002},
+		{20, 20, 0x3012},
+		{21, 21, 0x3014},
+		{22, 0, 0},
+	}
+	for i, tt := range lines {
+		l, ok := obj.Lines.Address(tt.line)
+		if ok != (tt.expected != 0) || ok && (l.Line != tt.expected || l.Address != tt.address) {
+			t.Errorf("lines[%d] - Address(%d) wrong. expected=%d x%04X, got=%+v %t", i, tt.line, tt.expected, tt.address, l, ok)
+		}
+	}
+
+	addresses := []struct {
+		address uint16
+		line    int // Or 0 for none
+	}{
+		{0x2FFF, 0},
+		{0x3000, 2},
+		{0x3013, 20},
+		{0x3016, 21},
+		{0x3017, 0},
+	}
+	for i, tt := range addresses {
+		l, ok := obj.Lines.Lookup(tt.address)
+		if ok != (tt.line != 0) || l.Line != tt.line {
+			t.Errorf("addresses[%d] - Lookup(x%04X) wrong. expected=%d, got=%+v %t", i, tt.address, tt.line, l, ok)
+		}
+	}
+}
+
+func TestWriteObject(t *testing.T) {
+	obj := assemble(t, `.ORIG x3000
+AND R0,R0,#0
+HALT
+.END`)
+
+	var buf bytes.Buffer
+	if _, err := obj.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+
+	expected := []byte{0x30, 0x00, 0x50, 0x20, 0xF0, 0x25}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("object bytes wrong. expected=% X, got=% X", expected, buf.Bytes())
+	}
+}
+
+func TestReadObject(t *testing.T) {
+	obj, err := ReadObject(bytes.NewReader([]byte{0x30, 0x00, 0x50, 0x20, 0xF0, 0x25}))
+	if err != nil {
+		t.Fatalf("ReadObject failed: %s", err)
+	}
+	if obj.Origin != 0x3000 || len(obj.Code) != 2 || obj.Code[0] != 0x5020 || obj.Code[1] != 0xF025 {
+		t.Errorf("object wrong. got=x%04X %04X", obj.Origin, obj.Code)
+	}
+
+	malformed := [][]byte{{}, {0x30}, {0x30, 0x00, 0x50}, {0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00}}
+	for i, data := range malformed {
+		if _, err := ReadObject(bytes.NewReader(data)); err == nil {
+			t.Errorf("malformed[%d] - expected error", i)
+		}
+	}
+}
+
+func TestAssemblerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"ADD R0,R0,R0", []string{`1:1: "ADD" before .ORIG`}},
+		{".ORIG x3000\nLD R0,NOWHERE", []string{`2:7: undefined label "NOWHERE"`}},
+		{".ORIG x3000\nA ADD R0,R0,R0\nA HALT", []string{`3:1: label "A" already defined at 2:1`}},
+		{".ORIG x3000\n.ORIG x4000", []string{"2:1: multiple .ORIG directives"}},
+		{".ORIG x3000\n.BLKW #0", []string{"2:7: .BLKW count must be positive, got 0"}},
+		{"", []string{"-: missing .ORIG directive"}},
+		{".ORIG x3000\nADD R0", []string{"2:7: expected next token to be ,, got EOF \"\" instead"}},
+	}
+
+	for i, tt := range tests {
+		_, err := Assemble(tt.input)
+		list, ok := err.(ErrorList)
+		if !ok {
+			t.Errorf("tests[%d] - expected ErrorList, got=%v", i, err)
+			continue
+		}
+
+		if len(list) != len(tt.expected) {
+			t.Errorf("tests[%d] - wrong number of errors. expected=%d, got=%d: %v", i, len(tt.expected), len(list), list)
+			continue
+		}
+
+		for j, msg := range tt.expected {
+			if list[j].Error() != msg {
+				t.Errorf("tests[%d] - error[%d] wrong. expected=%q, got=%q", i, j, msg, list[j].Error())
+			}
+		}
+	}
+}
+
+func TestRangeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ADD R0,R0,#16", "2:11: immediate is 16, outside the imm5 range [-16, 15]"},
+		{"AND R0,R0,#-17", "2:11: immediate is -17, outside the imm5 range [-16, 15]"},
+		{"LDR R0,R1,#32", "2:11: offset is 32, outside the offset6 range [-32, 31]"},
+		{"STR R0,R1,#-33", "2:11: offset is -33, outside the offset6 range [-32, 31]"},
+		{"LD R0,#256", "2:7: offset is 256, outside the PCoffset9 range [-256, 255]"},
+		{"JSR #-1025", "2:5: offset is -1025, outside the PCoffset11 range [-1024, 1023]"},
+		{"TRAP x100", "2:6: trap vector is 256, outside the trapvect8 range [0, 255]"},
+		{".FILL #70000", "2:7: value is 70000, outside the 16-bit range [-32768, 65535]"},
+		{"ADD R0,R0,#'A'", "2:11: immediate is 65, outside the imm5 range [-16, 15]"},
+		{"BRz FAR\n.BLKW 256\nFAR HALT",
+			`2:5: distance to "FAR" from PC x3001 is 256, outside the PCoffset9 range [-256, 255]`},
+		{"BACK .BLKW 1024\nJSR BACK",
+			`3:5: distance to "BACK" from PC x3401 is -1025, outside the PCoffset11 range [-1024, 1023]`},
+	}
+
+	for i, tt := range tests {
+		_, err := Assemble(".ORIG x3000\n" + tt.input)
+		list, ok := err.(ErrorList)
+		if !ok || len(list) != 1 {
+			t.Errorf("tests[%d] - expected one error, got=%v", i, err)
+			continue
+		}
+
+		if list[0].Error() != tt.expected {
+			t.Errorf("tests[%d] - error wrong. expected=%q, got=%q", i, tt.expected, list[0].Error())
+		}
+	}
+
+	valid := []string{
+		"ADD R0,R0,#15\nAND R0,R0,#-16",
+		"LDR R0,R1,#31\nSTR R0,R1,#-32",
+		"TRAP #255\n.FILL #-32768\n.FILL #65535",
+		"BRz FAR\n.BLKW 255\nFAR HALT",
+		"BACK .BLKW 1023\nJSR BACK",
+	}
+
+	for i, input := range valid {
+		if _, err := Assemble(".ORIG x3000\n" + input); err != nil {
+			t.Errorf("valid[%d] - unexpected error: %s", i, err)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	obj := assemble(t, `.ORIG x3000
+.STRINGZ "a\tb\n\"\\\x41\0"`)
+
+	expected := []uint16{'a', '\t', 'b', '\n', '"', '\\', 'A', 0, 0}
+	if len(obj.Code) != len(expected) {
+		t.Fatalf("code length wrong. expected=%d, got=%d: %v", len(expected), len(obj.Code), obj.Code)
+	}
+	for i, word := range expected {
+		if obj.Code[i] != word {
+			t.Errorf("code[%d] wrong. expected=x%04X, got=x%04X", i, word, obj.Code[i])
+		}
+	}
+}
+
+func TestCharacters(t *testing.T) {
+	obj := assemble(t, `.ORIG x3000
+ADD R0,R0,#'\n'
+.FILL 'x'
+.FILL '\0'`)
+
+	expected := []uint16{0x102A, 'x', 0}
+	if len(obj.Code) != len(expected) {
+		t.Fatalf("code length wrong. expected=%d, got=%d: %v", len(expected), len(obj.Code), obj.Code)
+	}
+	for i, word := range expected {
+		if obj.Code[i] != word {
+			t.Errorf("code[%d] wrong. expected=x%04X, got=x%04X", i, word, obj.Code[i])
+		}
+	}
+}
+
+func assemble(t *testing.T, input string) *Object {
+	t.Helper()
+
+	obj, err := Assemble(input)
+	if err != nil {
+		t.Fatalf("assembly failed:\n%s", err)
+	}
+	return obj
+}
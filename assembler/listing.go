@@ -0,0 +1,88 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"lc3asm-parser/token"
+)
+
+// WriteTo writes the symbol table in the .sym format produced by lc3as.
+func (st *SymbolTable) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	b.WriteString("// Symbol table\n")
+	b.WriteString("// Scope level 0:\n")
+	b.WriteString("//\tSymbol Name       Page Address\n")
+	b.WriteString("//\t----------------  ------------\n")
+	for _, sym := range st.symbols {
+		fmt.Fprintf(&b, "//\t%-16s  %04X\n", sym.Name, sym.Address)
+	}
+	b.WriteString("\n")
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ReadSymbols reads a symbol table in the .sym format written by WriteTo.
+// Lines that are not symbols, such as the header, are skipped.
+func ReadSymbols(r io.Reader) (*SymbolTable, error) {
+	st := NewSymbolTable()
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(strings.TrimPrefix(scanner.Text(), "//"))
+		if len(fields) != 2 {
+			continue
+		}
+
+		address, err := strconv.ParseUint(fields[1], 16, 16)
+		if err != nil {
+			continue
+		}
+		st.Define(fields[0], uint16(address), token.Position{})
+	}
+	return st, scanner.Err()
+}
+
+// WriteListing writes every line of source next to the address, hex and
+// binary form of the words assembled from it. Statements that span more
+// than one word continue on the following rows without source.
+func (o *Object) WriteListing(w io.Writer, source string) error {
+	byLine := make(map[int][]Record)
+	for _, rec := range o.Records {
+		line := rec.Statement.Pos().Line
+		byLine[line] = append(byLine[line], rec)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-5s  %-5s  %-16s  %6s  %s\n", "Addr", "Hex", "Binary", "Line", "Source")
+
+	lines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	for i, text := range lines {
+		text = strings.TrimRight(text, "\r")
+		recs := byLine[i+1]
+		if len(recs) == 0 {
+			fmt.Fprintf(bw, "%-5s  %-5s  %-16s  (%4d)  %s\n", "", "", "", i+1, text)
+			continue
+		}
+
+		first := true
+		for _, rec := range recs {
+			for j, word := range rec.Words {
+				address := rec.Address + uint16(j)
+				if first {
+					fmt.Fprintf(bw, "x%04X  x%04X  %016b  (%4d)  %s\n", address, word, word, i+1, text)
+					first = false
+				} else {
+					fmt.Fprintf(bw, "x%04X  x%04X  %016b\n", address, word, word)
+				}
+			}
+		}
+	}
+
+	return bw.Flush()
+}
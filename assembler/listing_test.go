@@ -0,0 +1,91 @@
+package assembler
+
+import (
+	"bytes"
+	"testing"
+)
+
+const hello = `.ORIG x3000
+; print a greeting
+	LEA R0, MSG
+	PUTS
+	HALT
+MSG	.STRINGZ "Hi"
+.END
+`
+
+func TestWriteSymbols(t *testing.T) {
+	obj := assemble(t, program)
+
+	var buf bytes.Buffer
+	if _, err := obj.Symbols.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+
+	expected := `// Symbol table
+// Scope level 0:
+//	Symbol Name       Page Address
+//	----------------  ------------
+//	START             3000
+//	LOOP              3002
+//	DONE              3007
+//	SUB               3008
+//	DATA              3010
+//	PTR               3011
+//	BUF               3012
+//	MSG               3014
+
+`
+
+	if buf.String() != expected {
+		t.Errorf("symbol file wrong. expected=\n%s\ngot=\n%s", expected, buf.String())
+	}
+}
+
+func TestReadSymbols(t *testing.T) {
+	obj := assemble(t, program)
+
+	var buf bytes.Buffer
+	obj.Symbols.WriteTo(&buf)
+	st, err := ReadSymbols(&buf)
+	if err != nil {
+		t.Fatalf("ReadSymbols failed: %s", err)
+	}
+
+	expected := obj.Symbols.Symbols()
+	symbols := st.Symbols()
+	if len(symbols) != len(expected) {
+		t.Fatalf("wrong number of symbols. expected=%d, got=%d", len(expected), len(symbols))
+	}
+	for i, sym := range expected {
+		if symbols[i].Name != sym.Name || symbols[i].Address != sym.Address {
+			t.Errorf("symbols[%d] wrong. expected=%s x%04X, got=%s x%04X",
+				i, sym.Name, sym.Address, symbols[i].Name, symbols[i].Address)
+		}
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	obj := assemble(t, hello)
+
+	var buf bytes.Buffer
+	if err := obj.WriteListing(&buf, hello); err != nil {
+		t.Fatalf("WriteListing failed: %s", err)
+	}
+
+	expected := `Addr   Hex    Binary              Line  Source
+                                (   1)  .ORIG x3000
+                                (   2)  ; print a greeting
+x3000  xE002  1110000000000010  (   3)  	LEA R0, MSG
+x3001  xF022  1111000000100010  (   4)  	PUTS
+x3002  xF025  1111000000100101  (   5)  	HALT
+x3003  x0048  0000000001001000  (   6)  MSG	.STRINGZ "Hi"
+x3004  x0069  0000000001101001
+x3005  x0000  0000000000000000
+                                (   7)  .END
+`
+
+	if buf.String() != expected {
+		t.Errorf("listing wrong. expected=\n%s\ngot=\n%s", expected, buf.String())
+	}
+}
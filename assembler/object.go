@@ -0,0 +1,107 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"lc3asm-parser/ast"
+)
+
+// Object is an assembled program: the words to load starting at Origin.
+type Object struct {
+	Origin  uint16
+	Code    []uint16
+	Symbols *SymbolTable
+	Records []Record
+	Lines   LineTable
+}
+
+// Record ties a statement to the address and words it assembled to. Only
+// statements that emit words have a record.
+type Record struct {
+	Statement ast.Statement
+	Address   uint16
+	Words     []uint16
+}
+
+// Line ties a source line to the words assembled from it.
+type Line struct {
+	Line    int
+	Address uint16
+	Size    int
+}
+
+// LineTable maps source lines to addresses and back. Statements are laid
+// out in source order, so entries are sorted both by line and by address.
+type LineTable []Line
+
+// lineTable builds the table for records, merging statements that share
+// a line.
+func lineTable(records []Record) LineTable {
+	var t LineTable
+	for _, rec := range records {
+		line := rec.Statement.Pos().Line
+		if n := len(t); n > 0 && t[n-1].Line == line {
+			t[n-1].Size += len(rec.Words)
+			continue
+		}
+		t = append(t, Line{Line: line, Address: rec.Address, Size: len(rec.Words)})
+	}
+	return t
+}
+
+// Address returns the entry for line, or for the first line after it that
+// assembled to anything. This is where a breakpoint set on line stops.
+func (t LineTable) Address(line int) (Line, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Line >= line })
+	if i == len(t) {
+		return Line{}, false
+	}
+	return t[i], true
+}
+
+// Lookup returns the entry whose words include address.
+func (t LineTable) Lookup(address uint16) (Line, bool) {
+	i := sort.Search(len(t), func(i int) bool { return int(t[i].Address)+t[i].Size > int(address) })
+	if i == len(t) || t[i].Address > address {
+		return Line{}, false
+	}
+	return t[i], true
+}
+
+// WriteTo writes the object in the .obj format loaded by the LC-3 tools:
+// big-endian words, the origin first followed by the code.
+func (o *Object) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, 2*(len(o.Code)+1))
+	binary.BigEndian.PutUint16(buf, o.Origin)
+	for i, word := range o.Code {
+		binary.BigEndian.PutUint16(buf[2*(i+1):], word)
+	}
+
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// ReadObject reads an object in the format written by WriteTo. The result
+// has no symbols, records or line table.
+func ReadObject(r io.Reader) (*Object, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || len(data)%2 != 0 {
+		return nil, fmt.Errorf("malformed object file: %d bytes", len(data))
+	}
+
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+
+	if int(words[0])+len(words)-1 > 1<<16 {
+		return nil, fmt.Errorf("object file does not fit in memory at x%04X", words[0])
+	}
+	return &Object{Origin: words[0], Code: words[1:], Symbols: NewSymbolTable()}, nil
+}
@@ -0,0 +1,43 @@
+package assembler
+
+import "lc3asm-parser/token"
+
+// Symbol is a label bound to the address it was defined at.
+type Symbol struct {
+	Name    string
+	Address uint16
+	Pos     token.Position
+}
+
+// SymbolTable holds the labels of a program in definition order.
+type SymbolTable struct {
+	store   map[string]*Symbol
+	symbols []*Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]*Symbol)}
+}
+
+// Define binds name to address. It returns the existing symbol and false
+// if name is already defined.
+func (st *SymbolTable) Define(name string, address uint16, pos token.Position) (*Symbol, bool) {
+	if sym, ok := st.store[name]; ok {
+		return sym, false
+	}
+
+	sym := &Symbol{Name: name, Address: address, Pos: pos}
+	st.store[name] = sym
+	st.symbols = append(st.symbols, sym)
+	return sym, true
+}
+
+func (st *SymbolTable) Resolve(name string) (*Symbol, bool) {
+	sym, ok := st.store[name]
+	return sym, ok
+}
+
+// Symbols returns the symbols in the order they were defined.
+func (st *SymbolTable) Symbols() []*Symbol {
+	return st.symbols
+}
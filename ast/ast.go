@@ -1,7 +1,10 @@
 package ast
 
+import "lc3asm-parser/token"
+
 type Node interface {
 	TokenLiteral() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -16,6 +19,28 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // All comments in source order
+
+	// Trivia holds the comments and blank lines around each statement.
+	// EndComments are the comments after the last statement.
+	Trivia      map[Statement]*Trivia
+	EndComments []*Comment
+}
+
+// TriviaOf returns the trivia of stmt, which is empty for a statement
+// without any.
+func (p *Program) TriviaOf(stmt Statement) Trivia {
+	if t, ok := p.Trivia[stmt]; ok {
+		return *t
+	}
+	return Trivia{}
+}
+
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
 }
 
 func (p *Program) TokenLiteral() string {
@@ -36,6 +61,7 @@ type ThreeRegisterStatement struct {
 
 func (trs *ThreeRegisterStatement) statementNode()       {}
 func (trs *ThreeRegisterStatement) TokenLiteral() string { return trs.Token.Literal }
+func (trs *ThreeRegisterStatement) Pos() token.Position  { return trs.Token.Pos }
 
 // ADD_i, AND_i
 type TwoRegisterImmediate struct {
@@ -43,34 +69,39 @@ type TwoRegisterImmediate struct {
 	Opcode         *Opcode
 	DataRegister   *Register
 	SourceRegister *Register
-	Immediate      int
+	Immediate      *IntegerLiteral
 }
 
 func (tri *TwoRegisterImmediate) statementNode()       {}
 func (tri *TwoRegisterImmediate) TokenLiteral() string { return tri.Token.Literal }
+func (tri *TwoRegisterImmediate) Pos() token.Position  { return tri.Token.Pos }
 
 // LD, LDI, LEA, ST, STI
+// Exactly one of Label and Offset is set.
 type RegisterLabelStatement struct {
 	Token    token.Token
 	Opcode   *Opcode
 	Register *Register
 	Label    *Label
+	Offset   *IntegerLiteral
 }
 
-// LDR, STR
 func (rls *RegisterLabelStatement) statementNode()       {}
 func (rls *RegisterLabelStatement) TokenLiteral() string { return rls.Token.Literal }
+func (rls *RegisterLabelStatement) Pos() token.Position  { return rls.Token.Pos }
 
+// LDR, STR
 type TwoRegisterOffset struct {
 	Token         token.Token
 	Opcode        *Opcode
 	LeftRegister  *Register
 	RightRegister *Register
-	Offset        int
+	Offset        *IntegerLiteral
 }
 
 func (tro *TwoRegisterOffset) statementNode()       {}
 func (tro *TwoRegisterOffset) TokenLiteral() string { return tro.Token.Literal }
+func (tro *TwoRegisterOffset) Pos() token.Position  { return tro.Token.Pos }
 
 // NOT
 type TwoRegister struct {
@@ -82,7 +113,159 @@ type TwoRegister struct {
 
 func (tr *TwoRegister) statementNode()       {}
 func (tr *TwoRegister) TokenLiteral() string { return tr.Token.Literal }
+func (tr *TwoRegister) Pos() token.Position  { return tr.Token.Pos }
+
+// JMP, JSRR
+type OneRegister struct {
+	Token    token.Token
+	Opcode   *Opcode
+	Register *Register
+}
+
+func (or *OneRegister) statementNode()       {}
+func (or *OneRegister) TokenLiteral() string { return or.Token.Literal }
+func (or *OneRegister) Pos() token.Position  { return or.Token.Pos }
+
+// BR, BRn, BRz, BRp, BRnz, BRnp, BRzp, BRnzp
+// N, Z and P record the condition codes as written, so a bare BR has none
+// set. Exactly one of Label and Offset is set.
+type BranchStatement struct {
+	Token  token.Token
+	Opcode *Opcode
+	N      bool
+	Z      bool
+	P      bool
+	Label  *Label
+	Offset *IntegerLiteral
+}
+
+func (bs *BranchStatement) statementNode()       {}
+func (bs *BranchStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BranchStatement) Pos() token.Position  { return bs.Token.Pos }
+
+// JSR
+// Exactly one of Label and Offset is set.
+type SubroutineStatement struct {
+	Token  token.Token
+	Opcode *Opcode
+	Label  *Label
+	Offset *IntegerLiteral
+}
+
+func (ss *SubroutineStatement) statementNode()       {}
+func (ss *SubroutineStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SubroutineStatement) Pos() token.Position  { return ss.Token.Pos }
+
+// RET, RTI
+type NoOperand struct {
+	Token  token.Token
+	Opcode *Opcode
+}
+
+func (no *NoOperand) statementNode()       {}
+func (no *NoOperand) TokenLiteral() string { return no.Token.Literal }
+func (no *NoOperand) Pos() token.Position  { return no.Token.Pos }
+
+// TRAP, GETC, OUT, PUTS, IN, PUTSP, HALT
+// For the aliases Vector is filled in from token.TrapVectors and shares the
+// alias token.
+type TrapStatement struct {
+	Token  token.Token
+	Opcode *Opcode
+	Vector *IntegerLiteral
+}
+
+func (ts *TrapStatement) statementNode()       {}
+func (ts *TrapStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TrapStatement) Pos() token.Position  { return ts.Token.Pos }
+
+// LabelReference returns the label stmt uses as an operand, or nil.
+func LabelReference(stmt Statement) *Label {
+	switch stmt := stmt.(type) {
+	case *RegisterLabelStatement:
+		return stmt.Label
+	case *BranchStatement:
+		return stmt.Label
+	case *SubroutineStatement:
+		return stmt.Label
+	case *FillDirective:
+		return stmt.Label
+	}
+	return nil
+}
+
+// IsData reports whether stmt reserves or initializes data rather than
+// assembling to an instruction.
+func IsData(stmt Statement) bool {
+	switch stmt.(type) {
+	case *FillDirective, *BlkwDirective, *StringzDirective:
+		return true
+	}
+	return false
+}
+
+// .ORIG
+type OrigDirective struct {
+	Token   token.Token
+	Address *IntegerLiteral
+}
 
+func (od *OrigDirective) statementNode()       {}
+func (od *OrigDirective) TokenLiteral() string { return od.Token.Literal }
+func (od *OrigDirective) Pos() token.Position  { return od.Token.Pos }
+
+// .FILL
+// Exactly one of Value and Label is set.
+type FillDirective struct {
+	Token token.Token
+	Value *IntegerLiteral
+	Label *Label
+}
+
+func (fd *FillDirective) statementNode()       {}
+func (fd *FillDirective) TokenLiteral() string { return fd.Token.Literal }
+func (fd *FillDirective) Pos() token.Position  { return fd.Token.Pos }
+
+// .BLKW
+type BlkwDirective struct {
+	Token token.Token
+	Count *IntegerLiteral
+}
+
+func (bd *BlkwDirective) statementNode()       {}
+func (bd *BlkwDirective) TokenLiteral() string { return bd.Token.Literal }
+func (bd *BlkwDirective) Pos() token.Position  { return bd.Token.Pos }
+
+// .STRINGZ
+type StringzDirective struct {
+	Token token.Token
+	Value *StringLiteral
+}
+
+func (sd *StringzDirective) statementNode()       {}
+func (sd *StringzDirective) TokenLiteral() string { return sd.Token.Literal }
+func (sd *StringzDirective) Pos() token.Position  { return sd.Token.Pos }
+
+// .END
+type EndDirective struct {
+	Token token.Token
+}
+
+func (ed *EndDirective) statementNode()       {}
+func (ed *EndDirective) TokenLiteral() string { return ed.Token.Literal }
+func (ed *EndDirective) Pos() token.Position  { return ed.Token.Pos }
+
+// .BEGIN
+type BeginDirective struct {
+	Token token.Token
+}
+
+func (bd *BeginDirective) statementNode()       {}
+func (bd *BeginDirective) TokenLiteral() string { return bd.Token.Literal }
+func (bd *BeginDirective) Pos() token.Position  { return bd.Token.Pos }
+
+// Opcode is an instruction name. Literal is its canonical spelling, such
+// as ADD or BRnz, whatever the case of the token in the source.
 type Opcode struct {
 	Token   token.Token
 	Literal string
@@ -90,16 +273,20 @@ type Opcode struct {
 
 func (o *Opcode) statementNode()       {}
 func (o *Opcode) TokenLiteral() string { return o.Token.Literal }
+func (o *Opcode) Pos() token.Position  { return o.Token.Pos }
 
+// R0-R7
 type Register struct {
 	Token token.Token
-	Value int
-	ID    int
+	ID    int // 0-7
 }
 
 func (r *Register) statementNode()       {}
 func (r *Register) TokenLiteral() string { return r.Token.Literal }
+func (r *Register) Pos() token.Position  { return r.Token.Pos }
 
+// Label is both a label definition, when it appears in
+// Program.Statements, and a reference to one when used as an operand.
 type Label struct {
 	Token token.Token
 	Value string
@@ -107,3 +294,46 @@ type Label struct {
 
 func (l *Label) statementNode()       {}
 func (l *Label) TokenLiteral() string { return l.Token.Literal }
+func (l *Label) Pos() token.Position  { return l.Token.Pos }
+
+// #5, x3000, -1
+type IntegerLiteral struct {
+	Token token.Token
+	Value int
+}
+
+func (il *IntegerLiteral) expressionNode()      {}
+func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+
+// "Hello\n"
+// Value has the escapes decoded; Token.Literal keeps them as written.
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+
+// ; text
+// Text includes the leading semicolon.
+type Comment struct {
+	Token       token.Token
+	Text        string
+	BlankBefore bool // Whether a blank line separates it from the line above
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos }
+
+// Trivia is what surrounds a statement in the source without meaning
+// anything to the assembler. When a label shares its line with an
+// instruction, Leading and BlankBefore belong to the label and Trailing
+// to the instruction.
+type Trivia struct {
+	Leading     []*Comment // Comments on their own lines since the previous statement
+	Trailing    *Comment   // Comment at the end of the same line
+	BlankBefore bool       // Whether a blank line separates it from the line above
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/cfg"
+)
+
+// controlFlow implements `cfg [-sym file.sym] [-o out.dot] file`, writing
+// the control-flow graph of an assembly source or object file as DOT.
+func controlFlow(args []string) error {
+	fs := flag.NewFlagSet("cfg", flag.ExitOnError)
+	out := fs.String("o", "", "DOT file to write (default: standard output)")
+	sym := fs.String("sym", "", "symbol table for an object file (default: the .sym next to it, if any)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: cfg [-sym file.sym] [-o out.dot] file.asm|file.obj")
+	}
+	path := fs.Arg(0)
+
+	var obj *assembler.Object
+	var err error
+	if filepath.Ext(path) == ".asm" {
+		obj, err = assembleFile(path)
+	} else {
+		obj, err = readObject(path, *sym)
+	}
+	if err != nil {
+		return err
+	}
+
+	g := cfg.Build(obj)
+	if *out == "" {
+		return g.WriteDOT(os.Stdout)
+	}
+	return writeFile(*out, func(w io.Writer) error {
+		return g.WriteDOT(w)
+	})
+}
@@ -0,0 +1,339 @@
+// Package cfg builds the control-flow graph of an assembled program:
+// its instructions grouped into basic blocks, the edges between them and
+// the subroutines they belong to.
+package cfg
+
+import (
+	"fmt"
+	"sort"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/ast"
+	"lc3asm-parser/disasm"
+	"lc3asm-parser/token"
+)
+
+// EdgeKind is how control passes along an edge.
+type EdgeKind int
+
+const (
+	Fallthrough EdgeKind = iota // On to the next instruction
+	Branch                      // A taken BR
+	Jump                        // JMP
+	Call                        // JSR, JSRR
+	Trap                        // TRAP other than HALT
+	Return                      // RET, RTI
+)
+
+func (k EdgeKind) String() string {
+	return [...]string{"fallthrough", "branch", "jump", "call", "trap", "return"}[k]
+}
+
+// Edge leaves a block. To is nil when the destination is not a block of
+// the graph: the target of JMP, JSRR, RET and RTI is only known at run
+// time, traps go into the operating system, and a target may lie outside
+// the program or in its data.
+type Edge struct {
+	Kind   EdgeKind
+	From   *Block
+	To     *Block
+	Target uint16 // Destination address when known, or the vector of a Trap
+	Known  bool   // Whether Target is set
+}
+
+// Block is a basic block: instructions that always run in sequence.
+// Blocks start at labels, at the targets of branches and calls and after
+// every instruction that transfers control.
+type Block struct {
+	Start        uint16 // Address of the first instruction
+	Label        string // Symbol at Start, if any
+	Instructions []disasm.Instruction
+
+	// Statements are the source statements of Instructions. They are
+	// only set for graphs built from an object with records.
+	Statements []ast.Statement
+
+	Succs      []*Edge
+	Preds      []*Edge
+	Subroutine *Subroutine // Nil for blocks no entry reaches
+}
+
+// End returns the address after the last instruction of b.
+func (b *Block) End() uint16 {
+	return b.Start + uint16(len(b.Instructions))
+}
+
+// Last returns the instruction that ends b.
+func (b *Block) Last() disasm.Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// Pos returns the source position of b, if known.
+func (b *Block) Pos() token.Position {
+	if len(b.Statements) == 0 {
+		return token.Position{}
+	}
+	return b.Statements[0].Pos()
+}
+
+// Subroutine is the code reached from an entry point without following
+// calls: the program itself from its origin, or a subroutine from the
+// target of a JSR. A block belongs to the first subroutine that reaches
+// it, the program first and then the others in address order.
+type Subroutine struct {
+	Name   string
+	Entry  *Block
+	Blocks []*Block // In address order
+}
+
+// Graph is the control-flow graph of a program.
+type Graph struct {
+	Entry       *Block   // The block at the origin, if it is code
+	Blocks      []*Block // In address order
+	Subroutines []*Subroutine
+
+	blocks map[uint16]*Block
+	labels disasm.Labels // Names from the symbol table, for WriteDOT
+}
+
+// Block returns the block starting at address.
+func (g *Graph) Block(address uint16) (*Block, bool) {
+	b, ok := g.blocks[address]
+	return b, ok
+}
+
+// Unreachable returns the blocks no path from the entry reaches, in
+// address order.
+func (g *Graph) Unreachable() []*Block {
+	var blocks []*Block
+	for _, b := range g.Blocks {
+		if b.Subroutine == nil {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+// Build returns the graph of obj. When obj has records, every statement
+// that is an instruction is code, so unreachable code still forms
+// blocks. Without records, as for an object read from disk, code is
+// found by following control flow from the origin and calls.
+func Build(obj *assembler.Object) *Graph {
+	code := make(map[uint16]disasm.Instruction)
+	statements := make(map[uint16]ast.Statement)
+
+	if len(obj.Records) > 0 {
+		for _, rec := range obj.Records {
+			if ast.IsData(rec.Statement) {
+				continue
+			}
+			inst, _ := disasm.Decode(rec.Address, rec.Words[0])
+			code[rec.Address] = inst
+			statements[rec.Address] = rec.Statement
+		}
+	} else {
+		follow(obj, code)
+	}
+
+	g := &Graph{blocks: make(map[uint16]*Block)}
+	if obj.Symbols != nil {
+		g.labels = disasm.SymbolLabels(obj.Symbols)
+	}
+
+	// Leaders start blocks: labels, jump targets and whatever follows a
+	// transfer of control
+	leaders := map[uint16]bool{obj.Origin: true}
+	if obj.Symbols != nil {
+		for _, sym := range obj.Symbols.Symbols() {
+			leaders[sym.Address] = true
+		}
+	}
+	for address, inst := range code {
+		if transfers(inst) {
+			leaders[address+1] = true
+			if inst.HasTarget {
+				leaders[inst.Target] = true
+			}
+		}
+	}
+
+	addresses := make([]int, 0, len(code))
+	for address := range code {
+		addresses = append(addresses, int(address))
+	}
+	sort.Ints(addresses)
+
+	var block *Block
+	for _, a := range addresses {
+		address := uint16(a)
+		if block == nil || leaders[address] || block.End() != address {
+			block = &Block{Start: address}
+			g.Blocks = append(g.Blocks, block)
+			g.blocks[address] = block
+		}
+		block.Instructions = append(block.Instructions, code[address])
+		if stmt, ok := statements[address]; ok {
+			block.Statements = append(block.Statements, stmt)
+		}
+	}
+
+	if obj.Symbols != nil {
+		for _, sym := range obj.Symbols.Symbols() {
+			if b, ok := g.blocks[sym.Address]; ok && b.Label == "" {
+				b.Label = sym.Name
+			}
+		}
+	}
+
+	for _, b := range g.Blocks {
+		g.connect(b)
+	}
+	g.Entry = g.blocks[obj.Origin]
+	g.findSubroutines()
+	return g
+}
+
+// connect adds the edges leaving b.
+func (g *Graph) connect(b *Block) {
+	inst := b.Last()
+	next := b.End()
+
+	switch op := inst.Word >> 12; {
+	case op == 0x0: // BR
+		g.edge(b, Branch, inst.Target, true)
+		if inst.Word&0x0E00 != 0x0E00 {
+			g.edge(b, Fallthrough, next, true)
+		}
+	case op == 0x4: // JSR, JSRR
+		g.edge(b, Call, inst.Target, inst.HasTarget)
+		g.edge(b, Fallthrough, next, true)
+	case op == 0x8: // RTI
+		g.edge(b, Return, 0, false)
+	case inst.Word == 0xC1C0: // RET
+		g.edge(b, Return, 0, false)
+	case op == 0xC: // JMP
+		g.edge(b, Jump, 0, false)
+	case inst.Mnemonic == "HALT":
+	case op == 0xF: // TRAP
+		g.edge(b, Trap, inst.Word&0xFF, true)
+		g.edge(b, Fallthrough, next, true)
+	default:
+		g.edge(b, Fallthrough, next, true)
+	}
+}
+
+func (g *Graph) edge(from *Block, kind EdgeKind, target uint16, known bool) {
+	e := &Edge{Kind: kind, From: from, Target: target, Known: known}
+	if known && kind != Trap {
+		e.To = g.blocks[target]
+	}
+	from.Succs = append(from.Succs, e)
+	if e.To != nil {
+		e.To.Preds = append(e.To.Preds, e)
+	}
+}
+
+// findSubroutines marks the blocks reached from the entry and from every
+// call target.
+func (g *Graph) findSubroutines() {
+	called := make(map[*Block]bool)
+	for _, b := range g.Blocks {
+		for _, e := range b.Succs {
+			if e.Kind == Call && e.To != nil {
+				called[e.To] = true
+			}
+		}
+	}
+
+	// g.Blocks is in address order, so the subroutines are as well
+	var entries []*Block
+	if g.Entry != nil {
+		entries = append(entries, g.Entry)
+	}
+	for _, b := range g.Blocks {
+		if called[b] {
+			entries = append(entries, b)
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.Subroutine != nil {
+			continue
+		}
+		sub := &Subroutine{Name: entry.Label, Entry: entry}
+		if sub.Name == "" {
+			sub.Name = fmt.Sprintf("L%04X", entry.Start)
+		}
+		g.Subroutines = append(g.Subroutines, sub)
+
+		work := []*Block{entry}
+		entry.Subroutine = sub
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			sub.Blocks = append(sub.Blocks, b)
+
+			for _, e := range b.Succs {
+				if e.To != nil && e.Kind != Call && e.To.Subroutine == nil {
+					e.To.Subroutine = sub
+					work = append(work, e.To)
+				}
+			}
+		}
+		sort.Slice(sub.Blocks, func(i, j int) bool { return sub.Blocks[i].Start < sub.Blocks[j].Start })
+	}
+}
+
+// follow fills code with the instructions reached from the origin of obj
+// by following control flow, calls included.
+func follow(obj *assembler.Object, code map[uint16]disasm.Instruction) {
+	inside := func(address uint16) bool {
+		return address >= obj.Origin && int(address-obj.Origin) < len(obj.Code)
+	}
+
+	work := []uint16{obj.Origin}
+	for len(work) > 0 {
+		address := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		for inside(address) {
+			if _, ok := code[address]; ok {
+				break
+			}
+			inst, ok := disasm.Decode(address, obj.Code[address-obj.Origin])
+			if !ok {
+				break
+			}
+			code[address] = inst
+
+			if inst.HasTarget && (inst.Word>>12 == 0x0 || inst.Word>>12 == 0x4) {
+				work = append(work, inst.Target)
+			}
+			if endsFlow(inst) {
+				break
+			}
+			address++
+		}
+	}
+}
+
+// transfers reports whether inst may pass control somewhere other than
+// the next instruction.
+func transfers(inst disasm.Instruction) bool {
+	switch inst.Word >> 12 {
+	case 0x0, 0x4, 0x8, 0xC, 0xF:
+		return true
+	}
+	return false
+}
+
+// endsFlow reports whether the instruction after inst never runs next.
+func endsFlow(inst disasm.Instruction) bool {
+	switch op := inst.Word >> 12; {
+	case op == 0x0:
+		return inst.Word&0x0E00 == 0x0E00
+	case op == 0x8, op == 0xC:
+		return true
+	}
+	return inst.Mnemonic == "HALT"
+}
@@ -0,0 +1,142 @@
+package cfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/lc3os"
+)
+
+const program = `	.ORIG x3000
+MAIN	LD R1,COUNT
+LOOP	JSR DOUBLE
+	ADD R1,R1,#-1
+	BRp LOOP
+	OUT
+	HALT
+DOUBLE	ST R7,SAVE
+	ADD R0,R0,R0
+	BRzp POS
+	NOT R0,R0
+POS	LD R7,SAVE
+	RET
+DEAD	ADD R0,R0,#1
+	RET
+COUNT	.FILL #3
+SAVE	.BLKW 1
+	.END`
+
+func TestBuild(t *testing.T) {
+	g := Build(assemble(t, program))
+
+	tests := []struct {
+		start      uint16
+		size       int
+		subroutine string
+		succs      []EdgeKind
+	}{
+		{0x3000, 1, "MAIN", []EdgeKind{Fallthrough}},
+		{0x3001, 1, "MAIN", []EdgeKind{Call, Fallthrough}},
+		{0x3002, 2, "MAIN", []EdgeKind{Branch, Fallthrough}},
+		{0x3004, 1, "MAIN", []EdgeKind{Trap, Fallthrough}},
+		{0x3005, 1, "MAIN", nil},
+		{0x3006, 3, "DOUBLE", []EdgeKind{Branch, Fallthrough}},
+		{0x3009, 1, "DOUBLE", []EdgeKind{Fallthrough}},
+		{0x300A, 2, "DOUBLE", []EdgeKind{Return}},
+		{0x300C, 2, "", []EdgeKind{Return}},
+	}
+
+	if len(g.Blocks) != len(tests) {
+		t.Fatalf("wrong number of blocks. expected=%d, got=%d", len(tests), len(g.Blocks))
+	}
+	for i, tt := range tests {
+		b := g.Blocks[i]
+		if b.Start != tt.start || len(b.Instructions) != tt.size || len(b.Statements) != tt.size {
+			t.Errorf("tests[%d] - block wrong. expected=x%04X+%d, got=x%04X+%d", i, tt.start, tt.size, b.Start, len(b.Instructions))
+		}
+
+		name := ""
+		if b.Subroutine != nil {
+			name = b.Subroutine.Name
+		}
+		if name != tt.subroutine {
+			t.Errorf("tests[%d] - subroutine wrong. expected=%q, got=%q", i, tt.subroutine, name)
+		}
+
+		if len(b.Succs) != len(tt.succs) {
+			t.Errorf("tests[%d] - wrong number of edges. expected=%d, got=%d", i, len(tt.succs), len(b.Succs))
+			continue
+		}
+		for j, kind := range tt.succs {
+			if b.Succs[j].Kind != kind {
+				t.Errorf("tests[%d] - edge[%d] wrong. expected=%s, got=%s", i, j, kind, b.Succs[j].Kind)
+			}
+		}
+	}
+
+	loop, _ := g.Block(0x3001)
+	if len(loop.Preds) != 2 || loop.Preds[0].From.Start != 0x3000 || loop.Preds[1].From.Start != 0x3002 {
+		t.Errorf("LOOP predecessors wrong. got=%v", loop.Preds)
+	}
+	if call := loop.Succs[0]; call.To == nil || call.To.Label != "DOUBLE" {
+		t.Errorf("call edge wrong. got=%+v", call)
+	}
+
+	if len(g.Subroutines) != 2 || g.Subroutines[1].Entry.Start != 0x3006 || len(g.Subroutines[1].Blocks) != 3 {
+		t.Errorf("subroutines wrong. got=%v", g.Subroutines)
+	}
+	if dead := g.Unreachable(); len(dead) != 1 || dead[0].Label != "DEAD" || dead[0].Pos().Line != 14 {
+		t.Errorf("unreachable blocks wrong. got=%v", dead)
+	}
+}
+
+func TestBuildFromObject(t *testing.T) {
+	obj := assemble(t, program)
+	obj.Records = nil
+
+	g := Build(obj)
+	if len(g.Blocks) != 8 || len(g.Unreachable()) != 0 {
+		t.Errorf("expected the 8 reachable blocks, got=%d", len(g.Blocks))
+	}
+	for _, b := range g.Blocks {
+		if b.Statements != nil {
+			t.Errorf("block x%04X has statements without records", b.Start)
+		}
+	}
+
+	// The operating system is entered through its vector tables
+	if g := Build(lc3os.Image()); len(g.Blocks) == 0 {
+		t.Errorf("expected blocks in the operating system")
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Build(assemble(t, program)).WriteDOT(&buf); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"digraph cfg {",
+		"\tsubgraph cluster_1 {\n\t\tlabel=\"DOUBLE\";\n",
+		`b3006 [label="DOUBLE:\lx3006  ST R7, SAVE\lx3007  ADD R0, R0, R0\lx3008  BRzp POS\l"];`,
+		"\tb3001 -> b3006 [style=dashed label=call];\n",
+		"\tb3004_0 [shape=plaintext label=\"trap x21\"];\n",
+		"\tb300A -> b300A_0 [style=dotted];\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("DOT output missing %q:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func assemble(t *testing.T, src string) *assembler.Object {
+	t.Helper()
+	obj, err := assembler.Assemble(src)
+	if err != nil {
+		t.Fatalf("assembly failed: %v", err)
+	}
+	return obj
+}
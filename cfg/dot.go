@@ -0,0 +1,93 @@
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes g in the Graphviz DOT language. Each subroutine is a
+// cluster, each block a node listing its instructions, and edges are
+// drawn by kind: calls dashed, fallthroughs gray. Edges without a block
+// at the end lead to a small node naming where they go.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph cfg {")
+	fmt.Fprintln(bw, "\tnode [shape=box fontname=monospace];")
+
+	writeBlock := func(indent string, b *Block) {
+		var lines []string
+		if b.Label != "" {
+			lines = append(lines, b.Label+":")
+		}
+		for _, inst := range b.Instructions {
+			lines = append(lines, fmt.Sprintf("x%04X  %s", inst.Address, inst.Format(g.labels)))
+		}
+		fmt.Fprintf(bw, "%s%s [label=%s];\n", indent, node(b), quote(strings.Join(lines, "\n")+"\n"))
+	}
+
+	for i, sub := range g.Subroutines {
+		fmt.Fprintf(bw, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(bw, "\t\tlabel=%s;\n", quote(sub.Name))
+		for _, b := range sub.Blocks {
+			writeBlock("\t\t", b)
+		}
+		fmt.Fprintln(bw, "\t}")
+	}
+	for _, b := range g.Unreachable() {
+		writeBlock("\t", b)
+	}
+
+	for _, b := range g.Blocks {
+		for i, e := range b.Succs {
+			to := ""
+			if e.To != nil {
+				to = node(e.To)
+			} else {
+				to = fmt.Sprintf("%s_%d", node(b), i)
+				fmt.Fprintf(bw, "\t%s [shape=plaintext label=%s];\n", to, quote(outside(e)))
+			}
+			fmt.Fprintf(bw, "\t%s -> %s [%s];\n", node(b), to, style(e.Kind))
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func node(b *Block) string {
+	return fmt.Sprintf("b%04X", b.Start)
+}
+
+// outside describes the destination of an edge that leaves the graph.
+func outside(e *Edge) string {
+	switch {
+	case e.Kind == Trap:
+		return fmt.Sprintf("trap x%02X", e.Target)
+	case e.Kind == Return:
+		return "return"
+	case e.Known:
+		return fmt.Sprintf("x%04X", e.Target)
+	}
+	return "?"
+}
+
+func style(kind EdgeKind) string {
+	switch kind {
+	case Fallthrough:
+		return "color=gray"
+	case Call, Trap:
+		return "style=dashed label=" + kind.String()
+	case Return:
+		return "style=dotted"
+	}
+	return "label=" + kind.String()
+}
+
+// quote writes s as a DOT string with left-justified lines.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + strings.ReplaceAll(s, "\n", `\l`) + `"`
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"lc3asm-parser/dap"
+)
+
+// debugAdapter implements `dap`, serving the Debug Adapter Protocol over
+// standard input and output.
+func debugAdapter(args []string) error {
+	fs := flag.NewFlagSet("dap", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return errors.New("usage: dap")
+	}
+	return dap.NewServer(os.Stdin, os.Stdout).Run()
+}
@@ -0,0 +1,398 @@
+package dap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lc3asm-parser/wire"
+)
+
+const program = `	.ORIG x3000
+	LEA R0,MSG
+	PUTS
+	AND R1,R1,#0
+	ADD R1,R1,#5
+LOOP	ADD R1,R1,#-1
+	BRp LOOP
+	GETC
+	OUT
+	HALT
+MSG	.STRINGZ "hi"
+	.END
+`
+
+type message struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client drives a server running in the background.
+type client struct {
+	t        *testing.T
+	w        *wire.Writer
+	seq      int
+	messages chan message
+	pending  []message // Events read while waiting for something else
+	output   strings.Builder
+	done     chan error
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: wire.NewWriter(inW), messages: make(chan message, 1000), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- NewServer(inR, outW).Run()
+		outW.Close()
+	}()
+	go func() {
+		r := wire.NewReader(outR)
+		defer close(c.messages)
+		for {
+			body, err := r.Read()
+			if err != nil {
+				return
+			}
+			var m message
+			if err := json.Unmarshal(body, &m); err != nil {
+				t.Error(err)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+func (c *client) next() message {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed its output")
+		}
+		if m.Event == "output" {
+			var o OutputEvent
+			json.Unmarshal(m.Body, &o)
+			c.output.WriteString(o.Output)
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+	}
+	return message{}
+}
+
+// request sends a request and returns its response, which is decoded
+// into body when it succeeds.
+func (c *client) request(command string, args interface{}, body interface{}) message {
+	c.t.Helper()
+	c.seq++
+	raw, _ := json.Marshal(args)
+	if err := c.w.Write(request{Seq: c.seq, Type: "request", Command: command, Arguments: raw}); err != nil {
+		c.t.Fatal(err)
+	}
+
+	for {
+		m := c.next()
+		if m.Type != "response" {
+			c.pending = append(c.pending, m)
+			continue
+		}
+		if m.RequestSeq != c.seq || m.Command != command {
+			c.t.Fatalf("response to %s #%d, expected %s #%d", m.Command, m.RequestSeq, command, c.seq)
+		}
+		if m.Success && body != nil {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				c.t.Fatalf("cannot decode %s response %s: %v", command, m.Body, err)
+			}
+		}
+		return m
+	}
+}
+
+// event waits for the named event.
+func (c *client) event(name string, body interface{}) {
+	c.t.Helper()
+	for {
+		var m message
+		if len(c.pending) > 0 {
+			m, c.pending = c.pending[0], c.pending[1:]
+		} else {
+			m = c.next()
+		}
+		if m.Type == "event" && m.Event == name {
+			if body != nil {
+				if err := json.Unmarshal(m.Body, body); err != nil {
+					c.t.Fatal(err)
+				}
+			}
+			return
+		}
+	}
+}
+
+func (c *client) stopped(reason string) StoppedEvent {
+	c.t.Helper()
+	var e StoppedEvent
+	c.event("stopped", &e)
+	if e.Reason != reason {
+		c.t.Fatalf("stopped for %q, expected %q (%s)", e.Reason, reason, e.Text)
+	}
+	return e
+}
+
+func (c *client) frame() StackFrame {
+	c.t.Helper()
+	var st StackTraceResponse
+	if m := c.request("stackTrace", map[string]int{"threadId": threadID}, &st); !m.Success {
+		c.t.Fatalf("stackTrace failed: %s", m.Message)
+	}
+	if len(st.StackFrames) != 1 {
+		c.t.Fatalf("wrong number of frames. got=%+v", st.StackFrames)
+	}
+	return st.StackFrames[0]
+}
+
+func (c *client) register(name string) string {
+	c.t.Helper()
+	var vars VariablesResponse
+	c.request("variables", VariablesArguments{VariablesReference: registersReference}, &vars)
+	for _, v := range vars.Variables {
+		if v.Name == name {
+			return v.Value
+		}
+	}
+	c.t.Fatalf("no variable %s in %+v", name, vars.Variables)
+	return ""
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.request("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		c.t.Errorf("Run failed: %v", err)
+	}
+}
+
+func writeProgram(t *testing.T, src string) string {
+	path := filepath.Join(t.TempDir(), "test.asm")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreakpoints(t *testing.T) {
+	path := writeProgram(t, program)
+	c := newClient(t)
+
+	var caps Capabilities
+	c.request("initialize", map[string]string{"adapterID": "lc3"}, &caps)
+	if !caps.SupportsStepBack || !caps.SupportsConditionalBreakpoints {
+		t.Errorf("capabilities wrong: %+v", caps)
+	}
+
+	if m := c.request("launch", LaunchArguments{Program: path}, nil); !m.Success {
+		t.Fatalf("launch failed: %s", m.Message)
+	}
+	c.event("initialized", nil)
+
+	var set SetBreakpointsResponse
+	c.request("setBreakpoints", SetBreakpointsArguments{
+		Source: Source{Path: path},
+		Breakpoints: []SourceBreakpoint{
+			{Line: 1},
+			{Line: 6, Condition: "R1 == 2"},
+			{Line: 7, Condition: "R1 =="},
+			{Line: 12},
+		},
+	}, &set)
+	tests := []struct {
+		verified bool
+		line     int
+	}{
+		{true, 2},
+		{true, 6},
+		{false, 7},
+		{false, 12},
+	}
+	if len(set.Breakpoints) != len(tests) {
+		t.Fatalf("wrong number of breakpoints. got=%+v", set.Breakpoints)
+	}
+	for i, tt := range tests {
+		bp := set.Breakpoints[i]
+		if bp.Verified != tt.verified || bp.Line != tt.line || !bp.Verified && bp.Message == "" {
+			t.Errorf("breakpoints[%d] wrong. expected verified=%t line=%d, got=%+v", i, tt.verified, tt.line, bp)
+		}
+	}
+
+	c.request("configurationDone", nil, nil)
+	e := c.stopped("breakpoint")
+	if len(e.HitBreakpointIDs) != 1 || e.HitBreakpointIDs[0] != set.Breakpoints[1].ID {
+		t.Errorf("hit breakpoints wrong. got=%v", e.HitBreakpointIDs)
+	}
+	if c.output.String() != "hi" {
+		t.Errorf("output wrong. got=%q", c.output.String())
+	}
+
+	frame := c.frame()
+	if frame.Name != "LOOP" || frame.Line != 6 || frame.Source == nil || frame.Source.Path != path {
+		t.Errorf("frame wrong: %+v", frame)
+	}
+	if r1 := c.register("R1"); r1 != "x0002 (#2)" {
+		t.Errorf("R1 wrong. got=%q", r1)
+	}
+	if pc := c.register("PC"); pc != "x3004" {
+		t.Errorf("PC wrong. got=%q", pc)
+	}
+
+	evaluations := []struct {
+		expr     string
+		expected string
+	}{
+		{"MSG", "x3009: x0068 (#104)"},
+		{"[MSG]", "x0068 (#104)"},
+		{"r1", "x0002 (#2)"},
+	}
+	for _, tt := range evaluations {
+		var result EvaluateResponse
+		c.request("evaluate", EvaluateArguments{Expression: tt.expr, Context: "watch"}, &result)
+		if result.Result != tt.expected {
+			t.Errorf("evaluate %s wrong. expected=%q, got=%q", tt.expr, tt.expected, result.Result)
+		}
+	}
+
+	var mem ReadMemoryResponse
+	c.request("readMemory", ReadMemoryArguments{MemoryReference: "MSG", Offset: 1, Count: 4}, &mem)
+	data, _ := base64.StdEncoding.DecodeString(mem.Data)
+	if mem.Address != "0x6013" || string(data) != "h\x00i\x00" {
+		t.Errorf("memory wrong. got=%s % X", mem.Address, data)
+	}
+
+	// Back over the BRp that led here, then forward again
+	c.request("stepBack", nil, nil)
+	c.stopped("step")
+	if line := c.frame().Line; line != 7 {
+		t.Errorf("line after stepBack wrong. expected=7, got=%d", line)
+	}
+	c.request("next", nil, nil)
+	c.stopped("step")
+	if line := c.frame().Line; line != 6 {
+		t.Errorf("line after next wrong. expected=6, got=%d", line)
+	}
+
+	// Run on to GETC, which waits for a key typed in the console
+	c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}}, &set)
+	c.request("continue", nil, nil)
+	if m := c.request("variables", VariablesArguments{VariablesReference: registersReference}, nil); m.Success {
+		t.Errorf("variables answered while running")
+	}
+	c.request("evaluate", EvaluateArguments{Expression: "x", Context: "repl"}, nil)
+	var exited ExitedEvent
+	c.event("exited", &exited)
+	c.event("terminated", nil)
+	if !strings.HasPrefix(c.output.String(), "hix") {
+		t.Errorf("output wrong. got=%q", c.output.String())
+	}
+
+	c.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+	path := writeProgram(t, program)
+	c := newClient(t)
+
+	c.request("initialize", nil, nil)
+	c.request("launch", LaunchArguments{Program: path, StopOnEntry: true, Input: "y"}, nil)
+	c.request("configurationDone", nil, nil)
+	c.stopped("entry")
+	if line := c.frame().Line; line != 2 {
+		t.Errorf("entry line wrong. expected=2, got=%d", line)
+	}
+
+	// Into PUTS, whose source is served by reference
+	c.request("stepIn", nil, nil)
+	c.stopped("step")
+	c.request("stepIn", nil, nil)
+	c.stopped("step")
+	frame := c.frame()
+	if frame.Source == nil || frame.Source.SourceReference != osSource || frame.Line == 0 {
+		t.Fatalf("frame in PUTS wrong: %+v", frame)
+	}
+	var src SourceResponse
+	c.request("source", SourceArguments{SourceReference: osSource}, &src)
+	lines := strings.Split(src.Content, "\n")
+	if frame.Line > len(lines) || strings.TrimSpace(lines[frame.Line-1]) == "" {
+		t.Errorf("frame line %d not in the operating system's source", frame.Line)
+	}
+
+	c.request("stepOut", nil, nil)
+	c.stopped("step")
+	if line := c.frame().Line; line != 4 {
+		t.Errorf("line after stepOut wrong. expected=4, got=%d", line)
+	}
+
+	// Breakpoints can be set while the program runs
+	c.request("setBreakpoints", SetBreakpointsArguments{
+		Source: Source{SourceReference: osSource}, Breakpoints: []SourceBreakpoint{{Line: 1}},
+	}, nil)
+	c.request("continue", nil, nil)
+	c.event("terminated", nil)
+	if !strings.HasPrefix(c.output.String(), "hiy") {
+		t.Errorf("output wrong. got=%q", c.output.String())
+	}
+
+	c.disconnect()
+}
+
+func TestPause(t *testing.T) {
+	path := writeProgram(t, `	.ORIG x3000
+LOOP	BRnzp LOOP
+	.END
+`)
+	c := newClient(t)
+
+	c.request("initialize", nil, nil)
+	c.request("launch", LaunchArguments{Program: path}, nil)
+	c.request("configurationDone", nil, nil)
+	c.request("pause", nil, nil)
+	c.stopped("pause")
+	if frame := c.frame(); frame.Name != "LOOP" {
+		t.Errorf("frame wrong: %+v", frame)
+	}
+
+	c.request("continue", nil, nil)
+	c.disconnect()
+}
+
+func TestLaunchErrors(t *testing.T) {
+	path := writeProgram(t, "\t.ORIG x3000\n\tBRnzp NOWHERE\n\t.END\n")
+	c := newClient(t)
+
+	c.request("initialize", nil, nil)
+	m := c.request("launch", LaunchArguments{Program: path}, nil)
+	if m.Success || !strings.HasPrefix(m.Message, path+":2:") {
+		t.Errorf("launch of a bad program wrong: %+v", m)
+	}
+	if m := c.request("stackTrace", nil, nil); m.Success {
+		t.Errorf("stackTrace answered without a program")
+	}
+	if m := c.request("attach", nil, nil); m.Success {
+		t.Errorf("unsupported request answered")
+	}
+
+	c.disconnect()
+}
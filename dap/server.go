@@ -0,0 +1,619 @@
+// Package dap is a Debug Adapter Protocol server for LC-3 programs. It
+// assembles the program named by launch and drives it through a
+// debugger.Session: breakpoints are set on source lines through the
+// assembler's line table, the registers are shown as variables and
+// memory can be read by address or label. What the program displays is
+// sent as output, and text entered in the debug console while it runs is
+// typed on its keyboard.
+package dap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/debugger"
+	"lc3asm-parser/lc3os"
+	"lc3asm-parser/vm"
+	"lc3asm-parser/wire"
+)
+
+const (
+	threadID           = 1 // The machine is the only thread
+	frameID            = 1 // Frames are not tracked; the PC is the only one
+	registersReference = 1
+	osSource           = 1 // Source reference of the operating system
+)
+
+// Server debugs one program for one client over a pair of streams.
+type Server struct {
+	in  *wire.Reader
+	out *wire.Writer
+
+	mu  sync.Mutex // Orders sequence numbers with writes
+	seq int
+
+	handlers map[string]func(s *Server, args json.RawMessage) (interface{}, error)
+	after    []func() // Run once the current request is answered
+
+	session     *debugger.Session
+	obj         *assembler.Object
+	path        string
+	keyboard    *io.PipeWriter
+	stopOnEntry bool
+	configured  bool
+	started     bool
+	sources     map[string][]int // IDs of the breakpoints set in each source
+
+	running atomic.Bool
+	done    chan struct{} // Closed when the running command stops
+}
+
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{
+		in:      wire.NewReader(r),
+		out:     wire.NewWriter(w),
+		sources: make(map[string][]int),
+		handlers: map[string]func(s *Server, args json.RawMessage) (interface{}, error){
+			"initialize":        (*Server).initialize,
+			"launch":            (*Server).launch,
+			"setBreakpoints":    (*Server).setBreakpoints,
+			"configurationDone": (*Server).configurationDone,
+			"threads":           (*Server).threads,
+			"stackTrace":        (*Server).stackTrace,
+			"scopes":            (*Server).scopes,
+			"variables":         (*Server).variables,
+			"evaluate":          (*Server).evaluate,
+			"readMemory":        (*Server).readMemory,
+			"source":            (*Server).source,
+			"continue":          (*Server).continueRequest,
+			"next":              (*Server).next,
+			"stepIn":            (*Server).stepIn,
+			"stepOut":           (*Server).stepOut,
+			"stepBack":          (*Server).stepBack,
+			"reverseContinue":   (*Server).reverseContinue,
+			"pause":             (*Server).pause,
+		},
+	}
+}
+
+// Run serves requests until the client disconnects or closes the input.
+func (s *Server) Run() error {
+	defer func() {
+		s.stop()
+		if s.keyboard != nil {
+			s.keyboard.Close()
+		}
+	}()
+
+	for {
+		body, err := s.in.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("malformed request: %v", err)
+		}
+		if req.Command == "disconnect" {
+			s.stop()
+			return s.respond(req, nil, nil)
+		}
+
+		var result interface{}
+		if handler, ok := s.handlers[req.Command]; ok {
+			result, err = handler(s, req.Arguments)
+		} else {
+			err = fmt.Errorf("unsupported request %q", req.Command)
+		}
+		if err := s.respond(req, result, err); err != nil {
+			return err
+		}
+
+		// Work queued here may queue more
+		for len(s.after) > 0 {
+			f := s.after[0]
+			s.after = s.after[1:]
+			f()
+		}
+	}
+}
+
+func (s *Server) respond(req request, body interface{}, err error) error {
+	resp := response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	resp.Seq = s.seq
+	return s.out.Write(resp)
+}
+
+func (s *Server) send(name string, body interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	// A client gone away is noticed when reading its next request
+	s.out.Write(event{Seq: s.seq, Type: "event", Event: name, Body: body})
+}
+
+// later runs f after the response to the current request, so that events
+// it sends follow the response.
+func (s *Server) later(f func()) {
+	s.after = append(s.after, f)
+}
+
+func decode(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return json.Unmarshal(args, v)
+}
+
+func (s *Server) initialize(json.RawMessage) (interface{}, error) {
+	return Capabilities{
+		SupportsConfigurationDoneRequest: true,
+		SupportsConditionalBreakpoints:   true,
+		SupportsEvaluateForHovers:        true,
+		SupportsStepBack:                 true,
+		SupportsReadMemoryRequest:        true,
+	}, nil
+}
+
+// launch assembles and loads the program. It starts running once the
+// client has finished setting breakpoints.
+func (s *Server) launch(raw json.RawMessage) (interface{}, error) {
+	var args LaunchArguments
+	if err := decode(raw, &args); err != nil {
+		return nil, err
+	}
+	if s.session != nil {
+		return nil, errors.New("a program is already launched")
+	}
+	if args.Program == "" {
+		return nil, errors.New("no program given")
+	}
+
+	src, err := os.ReadFile(args.Program)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := assembler.Assemble(string(src))
+	if list, ok := err.(assembler.ErrorList); ok {
+		msgs := make([]string, len(list))
+		for i, e := range list {
+			msgs[i] = fmt.Sprintf("%s:%s", args.Program, e)
+		}
+		return nil, errors.New(strings.Join(msgs, "\n"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := vm.New()
+	m.LoadImage(obj.Origin, obj.Code)
+	m.PC = obj.Origin
+
+	// The keyboard is read in the background, as for run, so that the
+	// program keeps going while it waits for input from the console
+	r, w := io.Pipe()
+	kb := vm.NewAsyncKeyboard(io.MultiReader(strings.NewReader(args.Input), r))
+	m.AttachKeyboardConsole(kb, output{s})
+
+	s.session = debugger.New(m, obj, string(src))
+	s.obj = obj
+	s.path = args.Program
+	s.keyboard = w
+	s.stopOnEntry = args.StopOnEntry
+
+	s.later(func() {
+		s.send("initialized", nil)
+		s.start()
+	})
+	return nil, nil
+}
+
+// output sends what the program displays to the client.
+type output struct {
+	s *Server
+}
+
+func (o output) Write(p []byte) (int, error) {
+	o.s.send("output", OutputEvent{Category: "stdout", Output: string(p)})
+	return len(p), nil
+}
+
+func (s *Server) configurationDone(json.RawMessage) (interface{}, error) {
+	s.configured = true
+	s.later(s.start)
+	return nil, nil
+}
+
+// start begins execution once the program is launched and configured.
+func (s *Server) start() {
+	if s.session == nil || !s.configured || s.started {
+		return
+	}
+	s.started = true
+
+	if s.stopOnEntry {
+		s.send("stopped", StoppedEvent{Reason: "entry", ThreadID: threadID, AllThreadsStopped: true})
+		return
+	}
+	s.execute(s.session.Continue)
+}
+
+// stopped returns an error unless the program is launched and stopped,
+// so that its state can be inspected.
+func (s *Server) stopped() error {
+	if s.session == nil {
+		return errors.New("no program launched")
+	}
+	if s.running.Load() {
+		return errors.New("program is running")
+	}
+	return nil
+}
+
+func (s *Server) setBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args SetBreakpointsArguments
+	if err := decode(raw, &args); err != nil {
+		return nil, err
+	}
+	if s.session == nil {
+		return nil, errors.New("no program launched")
+	}
+
+	var key string
+	var lines assembler.LineTable
+	switch {
+	case args.Source.SourceReference == osSource:
+		key, lines = "", lc3os.Image().Lines
+	case samePath(args.Source.Path, s.path):
+		key, lines = s.path, s.obj.Lines
+	default:
+		key = args.Source.Path
+	}
+
+	for _, id := range s.sources[key] {
+		s.session.Delete(id)
+	}
+	s.sources[key] = nil
+
+	result := SetBreakpointsResponse{Breakpoints: []Breakpoint{}}
+	for _, sbp := range args.Breakpoints {
+		bp := Breakpoint{Source: &args.Source, Line: sbp.Line}
+
+		l, ok := lines.Address(sbp.Line)
+		var cond *debugger.Condition
+		var err error
+		if sbp.Condition != "" {
+			cond, err = debugger.ParseCondition(s.session, sbp.Condition)
+		}
+		switch {
+		case lines == nil:
+			bp.Message = "not a source of the program"
+		case !ok:
+			bp.Message = "no instruction at or after this line"
+		case err != nil:
+			bp.Message = err.Error()
+		default:
+			set := s.session.BreakIf(l.Address, cond)
+			s.sources[key] = append(s.sources[key], set.ID)
+			bp.ID, bp.Verified, bp.Line = set.ID, true, l.Line
+		}
+		result.Breakpoints = append(result.Breakpoints, bp)
+	}
+	return result, nil
+}
+
+func samePath(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+func (s *Server) threads(json.RawMessage) (interface{}, error) {
+	return ThreadsResponse{Threads: []Thread{{ID: threadID, Name: "LC-3"}}}, nil
+}
+
+func (s *Server) stackTrace(json.RawMessage) (interface{}, error) {
+	if err := s.stopped(); err != nil {
+		return nil, err
+	}
+
+	pc := s.session.Machine.PC
+	name := s.session.Label(pc)
+	if name == "" {
+		name = fmt.Sprintf("x%04X", pc)
+	}
+	frame := StackFrame{ID: frameID, Name: name, Column: 1, InstructionPointerReference: fmt.Sprintf("x%04X", pc)}
+	frame.Source, frame.Line = s.location(pc)
+	return StackTraceResponse{StackFrames: []StackFrame{frame}, TotalFrames: 1}, nil
+}
+
+// location returns the source and line of the statement that assembled to
+// address, from the program or the operating system.
+func (s *Server) location(address uint16) (*Source, int) {
+	if l, ok := s.obj.Lines.Lookup(address); ok {
+		return &Source{Name: filepath.Base(s.path), Path: s.path}, l.Line
+	}
+	if l, ok := lc3os.Image().Lines.Lookup(address); ok {
+		return &Source{Name: "lc3os.asm", SourceReference: osSource}, l.Line
+	}
+	return nil, 0
+}
+
+func (s *Server) scopes(json.RawMessage) (interface{}, error) {
+	return ScopesResponse{Scopes: []Scope{{Name: "Registers", VariablesReference: registersReference}}}, nil
+}
+
+func (s *Server) variables(raw json.RawMessage) (interface{}, error) {
+	var args VariablesArguments
+	if err := decode(raw, &args); err != nil {
+		return nil, err
+	}
+	if err := s.stopped(); err != nil {
+		return nil, err
+	}
+	if args.VariablesReference != registersReference {
+		return VariablesResponse{Variables: []Variable{}}, nil
+	}
+
+	m := s.session.Machine
+	var vars []Variable
+	for i, r := range m.Registers {
+		vars = append(vars, Variable{Name: fmt.Sprintf("R%d", i), Value: word(r), MemoryReference: fmt.Sprintf("x%04X", r)})
+	}
+	vars = append(vars, Variable{Name: "PC", Value: fmt.Sprintf("x%04X", m.PC), MemoryReference: fmt.Sprintf("x%04X", m.PC)})
+
+	mode := "user"
+	if m.Supervisor() {
+		mode = "supervisor"
+	}
+	vars = append(vars, Variable{
+		Name:  "PSR",
+		Value: fmt.Sprintf("x%04X (%s, priority %d, %s)", m.PSR, mode, m.Priority(), condition(m.Cond())),
+	})
+	return VariablesResponse{Variables: vars}, nil
+}
+
+// word shows a register or memory word in hex and as a signed number.
+func word(w uint16) string {
+	return fmt.Sprintf("x%04X (#%d)", w, int16(w))
+}
+
+func condition(cc uint16) string {
+	switch cc {
+	case vm.FlagN:
+		return "N"
+	case vm.FlagZ:
+		return "Z"
+	case vm.FlagP:
+		return "P"
+	}
+	return "?"
+}
+
+// evaluate types the expression on the keyboard when it is entered in the
+// console while the program runs. Otherwise it shows a register, a
+// location written as a label or number with the word stored there, or,
+// for [LOCATION], the word alone.
+func (s *Server) evaluate(raw json.RawMessage) (interface{}, error) {
+	var args EvaluateArguments
+	if err := decode(raw, &args); err != nil {
+		return nil, err
+	}
+	if s.session != nil && s.running.Load() && args.Context == "repl" {
+		if _, err := io.WriteString(s.keyboard, args.Expression+"\n"); err != nil {
+			return nil, err
+		}
+		return EvaluateResponse{}, nil
+	}
+	if err := s.stopped(); err != nil {
+		return nil, err
+	}
+
+	m := s.session.Machine
+	expr := strings.TrimSpace(args.Expression)
+	switch upper := strings.ToUpper(expr); {
+	case len(upper) == 2 && upper[0] == 'R' && '0' <= upper[1] && upper[1] <= '7':
+		return EvaluateResponse{Result: word(m.Registers[upper[1]-'0'])}, nil
+	case upper == "PC":
+		return EvaluateResponse{Result: fmt.Sprintf("x%04X", m.PC)}, nil
+	case upper == "PSR":
+		return EvaluateResponse{Result: fmt.Sprintf("x%04X", m.PSR)}, nil
+	}
+
+	if strings.HasPrefix(expr, "[") && strings.HasSuffix(expr, "]") {
+		address, err := s.session.Resolve(strings.TrimSpace(expr[1 : len(expr)-1]))
+		if err != nil {
+			return nil, err
+		}
+		return EvaluateResponse{Result: word(m.Memory[address])}, nil
+	}
+
+	address, err := s.session.Resolve(expr)
+	if err != nil {
+		return nil, err
+	}
+	return EvaluateResponse{
+		Result:          fmt.Sprintf("x%04X: %s", address, word(m.Memory[address])),
+		MemoryReference: fmt.Sprintf("x%04X", address),
+	}, nil
+}
+
+func (s *Server) readMemory(raw json.RawMessage) (interface{}, error) {
+	var args ReadMemoryArguments
+	if err := decode(raw, &args); err != nil {
+		return nil, err
+	}
+	if err := s.stopped(); err != nil {
+		return nil, err
+	}
+	address, err := s.session.Resolve(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bytes past the end of memory cannot be read
+	start := 2*int(address) + args.Offset
+	if start < 0 || start > 2*vm.MemorySize || args.Count < 0 {
+		return nil, fmt.Errorf("offset %d from %s is outside memory", args.Offset, args.MemoryReference)
+	}
+	end := start + args.Count
+	unreadable := 0
+	if end > 2*vm.MemorySize {
+		unreadable = end - 2*vm.MemorySize
+		end = 2 * vm.MemorySize
+	}
+
+	data := make([]byte, 0, end-start)
+	for i := start; i < end; i++ {
+		w := s.session.Machine.Memory[i/2]
+		if i%2 == 0 {
+			data = append(data, byte(w>>8))
+		} else {
+			data = append(data, byte(w))
+		}
+	}
+	return ReadMemoryResponse{
+		Address:         fmt.Sprintf("0x%X", start),
+		UnreadableBytes: unreadable,
+		Data:            base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+func (s *Server) source(raw json.RawMessage) (interface{}, error) {
+	var args SourceArguments
+	if err := decode(raw, &args); err != nil {
+		return nil, err
+	}
+	ref := args.SourceReference
+	if args.Source != nil && args.Source.SourceReference != 0 {
+		ref = args.Source.SourceReference
+	}
+	if ref != osSource {
+		return nil, fmt.Errorf("no source with reference %d", ref)
+	}
+	return SourceResponse{Content: lc3os.Source, MimeType: "text/x-lc3"}, nil
+}
+
+func (s *Server) continueRequest(json.RawMessage) (interface{}, error) {
+	if _, err := s.execute(s.session.Continue); err != nil {
+		return nil, err
+	}
+	return map[string]bool{"allThreadsContinued": true}, nil
+}
+
+func (s *Server) next(json.RawMessage) (interface{}, error) {
+	return s.execute(s.session.Next)
+}
+
+func (s *Server) stepIn(json.RawMessage) (interface{}, error) {
+	return s.execute(s.session.Step)
+}
+
+func (s *Server) stepOut(json.RawMessage) (interface{}, error) {
+	return s.execute(s.session.Finish)
+}
+
+func (s *Server) stepBack(json.RawMessage) (interface{}, error) {
+	return s.execute(s.session.ReverseStep)
+}
+
+func (s *Server) reverseContinue(json.RawMessage) (interface{}, error) {
+	return s.execute(s.session.ReverseContinue)
+}
+
+func (s *Server) pause(json.RawMessage) (interface{}, error) {
+	if s.running.Load() {
+		go s.interrupt(s.done)
+	}
+	return nil, nil
+}
+
+// execute starts command in the background once the current request is
+// answered, and reports where it stops with an event.
+func (s *Server) execute(command func() (debugger.Stop, error)) (interface{}, error) {
+	if err := s.stopped(); err != nil {
+		return nil, err
+	}
+
+	s.running.Store(true)
+	s.done = make(chan struct{})
+	done := s.done
+	s.later(func() {
+		go func() {
+			stop, err := command()
+			s.running.Store(false)
+			close(done)
+			s.report(stop, err)
+		}()
+	})
+	return nil, nil
+}
+
+// report tells the client why the program stopped.
+func (s *Server) report(stop debugger.Stop, err error) {
+	e := StoppedEvent{ThreadID: threadID, AllThreadsStopped: true}
+	switch {
+	case err != nil:
+		e.Reason, e.Description, e.Text = "exception", "Exception", err.Error()
+	case stop.Reason == debugger.Halted:
+		s.send("exited", ExitedEvent{ExitCode: 0})
+		s.send("terminated", nil)
+		return
+	case stop.Reason == debugger.BreakpointHit:
+		e.Reason, e.HitBreakpointIDs = "breakpoint", []int{stop.Breakpoint.ID}
+	case stop.Reason == debugger.Paused:
+		e.Reason = "pause"
+	case stop.Reason == debugger.HistoryStart:
+		e.Reason, e.Description = "step", "Start of recorded history"
+	default:
+		e.Reason = "step"
+	}
+	s.send("stopped", e)
+}
+
+// stop pauses a running program and waits for it.
+func (s *Server) stop() {
+	if s.running.Load() {
+		s.interrupt(s.done)
+	}
+}
+
+// interrupt pauses the command that closes done when it stops. The pause
+// is repeated until then, since a command just starting clears it.
+func (s *Server) interrupt(done chan struct{}) {
+	for {
+		s.session.Pause()
+		select {
+		case <-done:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
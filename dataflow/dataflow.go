@@ -0,0 +1,395 @@
+// Package dataflow computes which register values reach and survive each
+// instruction of a control-flow graph: reaching definitions and liveness
+// over R0-R7 and the condition codes. The graph must have been built from
+// an object with records, since the analysis works on the registers named
+// by the source statements.
+package dataflow
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"lc3asm-parser/ast"
+	"lc3asm-parser/cfg"
+	"lc3asm-parser/token"
+)
+
+// CC stands for the condition codes next to the registers R0-R7.
+const CC = 8
+
+// Set is a set of registers, bit i standing for Ri and bit CC for the
+// condition codes.
+type Set uint16
+
+const (
+	all       Set = 1<<9 - 1
+	registers Set = 1<<8 - 1
+	callerSet Set = 1<<7 - 1 // R0-R6, what a routine called can see
+)
+
+func (s Set) Has(r int) bool { return s&(1<<r) != 0 }
+
+// Registers returns the members of s in order.
+func (s Set) Registers() []int {
+	var rs []int
+	for s != 0 {
+		r := bits.TrailingZeros16(uint16(s))
+		rs = append(rs, r)
+		s &^= 1 << r
+	}
+	return rs
+}
+
+func (s Set) String() string {
+	var names []string
+	for _, r := range s.Registers() {
+		names = append(names, Name(r))
+	}
+	return "{" + strings.Join(names, " ") + "}"
+}
+
+// Name returns R0-R7 or CC.
+func Name(r int) string {
+	if r == CC {
+		return "CC"
+	}
+	return fmt.Sprintf("R%d", r)
+}
+
+// Reads returns the registers stmt names as sources, R7 for RET, and the
+// condition codes for a branch. AND with #0 is left out, since its result
+// does not depend on the register.
+func Reads(stmt ast.Statement) Set {
+	var s Set
+	add := func(r *ast.Register) { s |= 1 << r.ID }
+
+	switch stmt := stmt.(type) {
+	case *ast.ThreeRegisterStatement:
+		add(stmt.SourceRegisters[0])
+		add(stmt.SourceRegisters[1])
+	case *ast.TwoRegisterImmediate:
+		if stmt.Opcode.Literal != "AND" || stmt.Immediate.Value != 0 {
+			add(stmt.SourceRegister)
+		}
+	case *ast.TwoRegister:
+		add(stmt.SourceRegister)
+	case *ast.RegisterLabelStatement:
+		if isStore(stmt.Opcode) {
+			add(stmt.Register)
+		}
+	case *ast.TwoRegisterOffset:
+		add(stmt.RightRegister)
+		if isStore(stmt.Opcode) {
+			add(stmt.LeftRegister)
+		}
+	case *ast.OneRegister:
+		add(stmt.Register)
+	case *ast.NoOperand:
+		if stmt.Opcode.Literal == "RET" {
+			s |= 1 << 7
+		}
+	case *ast.BranchStatement:
+		s |= 1 << CC
+	}
+	return s
+}
+
+// Writes returns the register stmt names as its destination, with the
+// condition codes if it sets them.
+func Writes(stmt ast.Statement) Set {
+	switch stmt := stmt.(type) {
+	case *ast.ThreeRegisterStatement:
+		return 1<<stmt.DataRegister.ID | 1<<CC
+	case *ast.TwoRegisterImmediate:
+		return 1<<stmt.DataRegister.ID | 1<<CC
+	case *ast.TwoRegister:
+		return 1<<stmt.DataRegister.ID | 1<<CC
+	case *ast.RegisterLabelStatement:
+		if !isStore(stmt.Opcode) {
+			return 1<<stmt.Register.ID | 1<<CC
+		}
+	case *ast.TwoRegisterOffset:
+		if !isStore(stmt.Opcode) {
+			return 1<<stmt.LeftRegister.ID | 1<<CC
+		}
+	}
+	return 0
+}
+
+func isStore(o *ast.Opcode) bool {
+	return o.Literal == "ST" || o.Literal == "STI" || o.Literal == "STR"
+}
+
+// IsCall reports whether stmt runs another routine that returns: JSR,
+// JSRR or a TRAP other than HALT. The routine may read R0-R6 and may
+// leave anything in them and in the condition codes.
+func IsCall(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.SubroutineStatement:
+		return true
+	case *ast.OneRegister:
+		return stmt.Opcode.Literal == "JSRR"
+	case *ast.TrapStatement:
+		return stmt.Vector.Value != token.TrapVectors["HALT"]
+	}
+	return false
+}
+
+// effect is everything an instruction does to the registers, including
+// what the routine it calls may do.
+type effect struct {
+	uses Set // Read
+	defs Set // Written
+}
+
+func effectOf(stmt ast.Statement) effect {
+	e := effect{uses: Reads(stmt), defs: Writes(stmt)}
+
+	trap, isTrap := stmt.(*ast.TrapStatement)
+	switch {
+	case isTrap && trap.Vector.Value == token.TrapVectors["HALT"]:
+		// What a program leaves in its registers is its result
+		e.uses |= callerSet
+	case isTrap && known(trap.Vector.Value):
+		e.defs |= 1<<7 | 1<<CC
+		switch trap.Vector.Value {
+		case token.TrapVectors["GETC"], token.TrapVectors["IN"]:
+			e.defs |= 1 << 0
+		case token.TrapVectors["OUT"], token.TrapVectors["PUTS"], token.TrapVectors["PUTSP"]:
+			e.uses |= 1 << 0
+		}
+	case IsCall(stmt):
+		e.uses |= callerSet
+		e.defs |= all
+	}
+	return e
+}
+
+// known reports whether vector is one of the operating system's traps.
+func known(vector int) bool {
+	for _, v := range token.TrapVectors {
+		if v == vector {
+			return true
+		}
+	}
+	return false
+}
+
+// Def is a place a register value comes from: the instruction at Index
+// in Block, or, with Index -1, the entry of the subroutine that starts
+// at Block.
+type Def struct {
+	Block *cfg.Block
+	Index int
+}
+
+// Statement returns the instruction of d, or nil for an entry.
+func (d Def) Statement() ast.Statement {
+	if d.Index < 0 {
+		return nil
+	}
+	return d.Block.Statements[d.Index]
+}
+
+// Analysis holds the results for a graph.
+type Analysis struct {
+	Graph *cfg.Graph
+
+	defs    []Def
+	ids     map[Def]int
+	reachIn map[*cfg.Block]*state
+	liveOut map[*cfg.Block]Set
+}
+
+// state maps each register to the set of defs reaching a point, as bits
+// indexed like Analysis.defs.
+type state [CC + 1]bitset
+
+// Analyze computes reaching definitions and liveness over the blocks of
+// g that belong to a subroutine. Control passes along fallthrough,
+// branch and jump edges; a call is treated as one instruction that may
+// read R0-R6 and write anything.
+func Analyze(g *cfg.Graph) *Analysis {
+	a := &Analysis{
+		Graph:   g,
+		reachIn: make(map[*cfg.Block]*state),
+		liveOut: make(map[*cfg.Block]Set),
+	}
+	a.reaching()
+	a.liveness()
+	return a
+}
+
+// ReachingDefs returns the definitions of register r that reach the
+// instruction at index i of b.
+func (a *Analysis) ReachingDefs(b *cfg.Block, i, r int) []Def {
+	in, ok := a.reachIn[b]
+	if !ok {
+		return nil
+	}
+	s := *in
+	for j := 0; j < i; j++ {
+		a.transfer(&s, b, j)
+	}
+
+	var defs []Def
+	for _, id := range s[r].members() {
+		defs = append(defs, a.defs[id])
+	}
+	return defs
+}
+
+// LiveAfter returns the registers whose values may still be read after
+// the instruction at index i of b.
+func (a *Analysis) LiveAfter(b *cfg.Block, i int) Set {
+	live := a.liveOut[b]
+	for j := len(b.Statements) - 1; j > i; j-- {
+		e := effectOf(b.Statements[j])
+		live = live&^e.defs | e.uses
+	}
+	return live
+}
+
+// IsEntry reports whether d is the state of the registers when the
+// program starts, before any instruction has written them.
+func (a *Analysis) IsEntry(d Def) bool {
+	return d.Index < 0 && d.Block == a.Graph.Entry
+}
+
+func (a *Analysis) reaching() {
+	var blocks []*cfg.Block
+	for _, sub := range a.Graph.Subroutines {
+		blocks = append(blocks, sub.Blocks...)
+	}
+
+	// Number every definition; entries define every register
+	ids := make(map[Def]int)
+	define := func(d Def) {
+		if _, ok := ids[d]; !ok {
+			ids[d] = len(a.defs)
+			a.defs = append(a.defs, d)
+		}
+	}
+	for _, sub := range a.Graph.Subroutines {
+		define(Def{Block: sub.Entry, Index: -1})
+	}
+	for _, b := range blocks {
+		for i := range b.Statements {
+			define(Def{Block: b, Index: i})
+		}
+	}
+	a.ids = ids
+
+	for _, b := range blocks {
+		a.reachIn[b] = &state{}
+	}
+	for _, sub := range a.Graph.Subroutines {
+		id := ids[Def{Block: sub.Entry, Index: -1}]
+		for r := range a.reachIn[sub.Entry] {
+			a.reachIn[sub.Entry][r].add(id)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, b := range blocks {
+			out := *a.reachIn[b]
+			for i := range b.Statements {
+				a.transfer(&out, b, i)
+			}
+			for _, e := range b.Succs {
+				if e.To == nil || e.Kind == cfg.Call || e.To.Subroutine == nil {
+					continue
+				}
+				in := a.reachIn[e.To]
+				for r := range in {
+					if in[r].union(out[r]) {
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// transfer applies the instruction at index i of b to s.
+func (a *Analysis) transfer(s *state, b *cfg.Block, i int) {
+	e := effectOf(b.Statements[i])
+	id := a.ids[Def{Block: b, Index: i}]
+	for _, r := range e.defs.Registers() {
+		s[r] = nil
+		s[r].add(id)
+	}
+}
+
+func (a *Analysis) liveness() {
+	var blocks []*cfg.Block
+	for _, sub := range a.Graph.Subroutines {
+		blocks = append(blocks, sub.Blocks...)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(blocks) - 1; i >= 0; i-- {
+			b := blocks[i]
+			var out Set
+			for _, e := range b.Succs {
+				switch {
+				case e.Kind == cfg.Call || e.Kind == cfg.Trap:
+					// The call itself is accounted for by its effect
+				case e.Kind == cfg.Return:
+					// The caller may read any register
+					out |= registers
+				case e.To == nil:
+					// Control goes somewhere unknown
+					out |= registers
+				default:
+					out |= a.LiveAfter(e.To, -1)
+				}
+			}
+			if out != a.liveOut[b] {
+				a.liveOut[b] = out
+				changed = true
+			}
+		}
+	}
+}
+
+// bitset is a set of small integers. Copies of a state share their sets;
+// only the sets held by Analysis.reachIn are ever modified in place.
+type bitset []uint64
+
+func (b *bitset) add(i int) {
+	for len(*b) <= i/64 {
+		*b = append(*b, 0)
+	}
+	(*b)[i/64] |= 1 << (i % 64)
+}
+
+// union adds the members of o to b, reporting whether b changed.
+func (b *bitset) union(o bitset) bool {
+	changed := false
+	for i, word := range o {
+		if i >= len(*b) {
+			*b = append(*b, 0)
+		}
+		if (*b)[i]|word != (*b)[i] {
+			(*b)[i] |= word
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (b bitset) members() []int {
+	var ids []int
+	for i, word := range b {
+		for word != 0 {
+			j := bits.TrailingZeros64(word)
+			ids = append(ids, i*64+j)
+			word &^= 1 << j
+		}
+	}
+	return ids
+}
@@ -0,0 +1,135 @@
+package dataflow
+
+import (
+	"testing"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/cfg"
+)
+
+const program = `	.ORIG x3000
+	LD R1,COUNT
+	AND R0,R0,#0
+LOOP	ADD R0,R0,R1
+	JSR DOUBLE
+	ADD R1,R1,#-1
+	BRp LOOP
+	ST R0,RESULT
+	HALT
+DOUBLE	ADD R0,R0,R0
+	RET
+COUNT	.FILL #3
+RESULT	.BLKW 1
+	.END`
+
+func TestReadsAndWrites(t *testing.T) {
+	g := build(t, program)
+
+	tests := []struct {
+		address uint16
+		reads   Set
+		writes  Set
+	}{
+		{0x3000, 0, 1<<1 | 1<<CC},
+		{0x3001, 0, 1<<0 | 1<<CC},
+		{0x3002, 1<<0 | 1<<1, 1<<0 | 1<<CC},
+		{0x3003, 0, 0},
+		{0x3005, 1 << CC, 0},
+		{0x3006, 1 << 0, 0},
+		{0x3008, 1 << 0, 1<<0 | 1<<CC},
+		{0x3009, 1 << 7, 0},
+	}
+
+	for i, tt := range tests {
+		b, j := find(t, g, tt.address)
+		stmt := b.Statements[j]
+		if Reads(stmt) != tt.reads || Writes(stmt) != tt.writes {
+			t.Errorf("tests[%d] - x%04X wrong. expected=%s %s, got=%s %s",
+				i, tt.address, tt.reads, tt.writes, Reads(stmt), Writes(stmt))
+		}
+	}
+}
+
+func TestReachingDefs(t *testing.T) {
+	g := build(t, program)
+	a := Analyze(g)
+
+	// ADD R0,R0,R1 at LOOP sees R0 from the AND and from the call
+	b, i := find(t, g, 0x3002)
+	defs := a.ReachingDefs(b, i, 0)
+	if len(defs) != 2 || address(defs[0]) != 0x3001 || address(defs[1]) != 0x3003 {
+		t.Errorf("R0 defs at LOOP wrong. got=%v", defs)
+	}
+
+	// Before the loop nothing has written R2, so only the program entry
+	// reaches; at LOOP the call may have written it too
+	b0, i0 := find(t, g, 0x3001)
+	if defs := a.ReachingDefs(b0, i0, 2); len(defs) != 1 || !a.IsEntry(defs[0]) {
+		t.Errorf("R2 defs before LOOP wrong. got=%v", defs)
+	}
+	if defs := a.ReachingDefs(b, i, 2); len(defs) != 2 || !a.IsEntry(defs[0]) || address(defs[1]) != 0x3003 {
+		t.Errorf("R2 defs at LOOP wrong. got=%v", defs)
+	}
+
+	// Inside DOUBLE, R0 comes from the caller
+	b, i = find(t, g, 0x3008)
+	defs = a.ReachingDefs(b, i, 0)
+	if len(defs) != 1 || defs[0].Index != -1 || a.IsEntry(defs[0]) {
+		t.Errorf("R0 defs in DOUBLE wrong. got=%v", defs)
+	}
+
+	// The branch tests the condition codes set by the ADD before it
+	b, i = find(t, g, 0x3005)
+	defs = a.ReachingDefs(b, i, CC)
+	if len(defs) != 1 || address(defs[0]) != 0x3004 {
+		t.Errorf("CC defs at BRp wrong. got=%v", defs)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	g := build(t, program)
+	a := Analyze(g)
+
+	tests := []struct {
+		address uint16
+		live    Set
+	}{
+		{0x3000, 1<<1 | 1<<2 | 1<<3 | 1<<4 | 1<<5 | 1<<6}, // R0 is cleared next
+		{0x3003, all &^ (1<<7 | 1<<CC)},                   // After the call
+		{0x3004, all &^ (1 << 7)},                         // The branch reads CC
+		{0x3006, callerSet},                               // HALT keeps the results
+		{0x3008, registers},                               // The caller may read anything
+	}
+
+	for i, tt := range tests {
+		b, j := find(t, g, tt.address)
+		if live := a.LiveAfter(b, j); live != tt.live {
+			t.Errorf("tests[%d] - live after x%04X wrong. expected=%s, got=%s", i, tt.address, tt.live, live)
+		}
+	}
+}
+
+func build(t *testing.T, src string) *cfg.Graph {
+	t.Helper()
+	obj, err := assembler.Assemble(src)
+	if err != nil {
+		t.Fatalf("assembly failed: %v", err)
+	}
+	return cfg.Build(obj)
+}
+
+// find returns the block and index of the instruction at address.
+func find(t *testing.T, g *cfg.Graph, address uint16) (*cfg.Block, int) {
+	t.Helper()
+	for _, b := range g.Blocks {
+		if address >= b.Start && address < b.End() {
+			return b, int(address - b.Start)
+		}
+	}
+	t.Fatalf("no instruction at x%04X", address)
+	return nil, 0
+}
+
+func address(d Def) uint16 {
+	return d.Block.Start + uint16(d.Index)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/debugger"
+	"lc3asm-parser/vm"
+)
+
+// debugProgram implements `debug file.asm|file.obj`. An object file's
+// labels come from the .sym file next to it, if there is one.
+func debugProgram(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	history := fs.Int("history", debugger.DefaultHistory, "number of instructions recorded for reverse execution")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: debug [-history N] file.asm|file.obj")
+	}
+	path := fs.Arg(0)
+
+	var obj *assembler.Object
+	var src []byte
+	var err error
+
+	if filepath.Ext(path) == ".asm" {
+		if src, err = os.ReadFile(path); err != nil {
+			return err
+		}
+		if obj, err = assembleSource(path, string(src)); err != nil {
+			return err
+		}
+	} else if obj, err = readObject(path, ""); err != nil {
+		return err
+	}
+
+	m := vm.New()
+	m.LoadImage(obj.Origin, obj.Code)
+	m.PC = obj.Origin
+
+	// The program's keyboard shares the prompt's input
+	in := bufio.NewReader(os.Stdin)
+	m.AttachConsole(in, os.Stdout)
+
+	session := debugger.New(m, obj, string(src))
+	session.HistoryLimit = *history
+
+	// Ctrl-C stops a running program instead of the debugger
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			session.Pause()
+		}
+	}()
+
+	debugger.Start(in, os.Stdout, session)
+	return nil
+}
@@ -0,0 +1,282 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Condition is a boolean expression over the machine state, such as
+// R3 == x0000 && PC == LOOP. Operands are registers (R0-R7, PC, PSR),
+// numbers, labels, which stand for their address, and memory words
+// written [LOCATION]. Values are unsigned 16-bit words; the operators are
+// ! - + == != < <= > >= && || and parentheses.
+type Condition struct {
+	text string
+	root node
+}
+
+// ParseCondition parses text, resolving labels through s.
+func ParseCondition(s *Session, text string) (*Condition, error) {
+	p := &condParser{s: s, tokens: scanCondition(text)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("unexpected %q in condition", tok)
+	}
+	return &Condition{text: strings.Join(strings.Fields(text), " "), root: root}, nil
+}
+
+func (c *Condition) String() string {
+	return c.text
+}
+
+// Eval reports whether the condition holds for s's machine.
+func (c *Condition) Eval(s *Session) bool {
+	return c.root.eval(s) != 0
+}
+
+type node interface {
+	eval(s *Session) int
+}
+
+type constant int
+
+func (n constant) eval(s *Session) int { return int(n) }
+
+// register is 0-7 for R0-R7, or one of the special registers below.
+type register int
+
+const (
+	regPC register = iota + 8
+	regPSR
+)
+
+func (n register) eval(s *Session) int {
+	switch n {
+	case regPC:
+		return int(s.Machine.PC)
+	case regPSR:
+		return int(s.Machine.PSR)
+	}
+	return int(s.Machine.Registers[n])
+}
+
+// memory is the word at the address its operand evaluates to.
+type memory struct {
+	address node
+}
+
+func (n memory) eval(s *Session) int {
+	return int(s.Machine.Memory[uint16(n.address.eval(s))])
+}
+
+type unary struct {
+	op      string
+	operand node
+}
+
+func (n unary) eval(s *Session) int {
+	value := n.operand.eval(s)
+	if n.op == "!" {
+		return truth(value == 0)
+	}
+	return int(uint16(-value))
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (n binary) eval(s *Session) int {
+	left := n.left.eval(s)
+	switch n.op {
+	case "&&":
+		return truth(left != 0 && n.right.eval(s) != 0)
+	case "||":
+		return truth(left != 0 || n.right.eval(s) != 0)
+	}
+
+	right := n.right.eval(s)
+	switch n.op {
+	case "+":
+		return int(uint16(left + right))
+	case "-":
+		return int(uint16(left - right))
+	case "==":
+		return truth(left == right)
+	case "!=":
+		return truth(left != right)
+	case "<":
+		return truth(left < right)
+	case "<=":
+		return truth(left <= right)
+	case ">":
+		return truth(left > right)
+	case ">=":
+		return truth(left >= right)
+	}
+	return 0
+}
+
+func truth(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// precedence levels from loosest to tightest for the binary operators
+// handled by parseBinary
+var levels = [][]string{
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+}
+
+type condParser struct {
+	s      *Session
+	tokens []string
+	pos    int
+}
+
+func (p *condParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *condParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *condParser) parseOr() (node, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *condParser) parseAnd() (node, error) {
+	return p.parseLogical("&&", func() (node, error) { return p.parseBinary(0) })
+}
+
+func (p *condParser) parseLogical(op string, operand func() (node, error)) (node, error) {
+	left, err := operand()
+	for err == nil && p.peek() == op {
+		p.next()
+		var right node
+		if right, err = operand(); err == nil {
+			left = binary{op, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *condParser) parseBinary(level int) (node, error) {
+	if level == len(levels) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	for err == nil && contains(levels[level], p.peek()) {
+		op := p.next()
+		var right node
+		if right, err = p.parseBinary(level + 1); err == nil {
+			left = binary{op, left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *condParser) parseUnary() (node, error) {
+	if op := p.peek(); op == "!" || op == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		return unary{op, operand}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *condParser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case "(", "[":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := map[string]string{"(": ")", "[": "]"}[tok]
+		if p.next() != closing {
+			return nil, fmt.Errorf("missing %q in condition", closing)
+		}
+		if tok == "[" {
+			return memory{inner}, nil
+		}
+		return inner, nil
+	}
+
+	switch upper := strings.ToUpper(tok); {
+	case upper == "PC":
+		return regPC, nil
+	case upper == "PSR":
+		return regPSR, nil
+	case len(upper) == 2 && upper[0] == 'R' && upper[1] >= '0' && upper[1] <= '7':
+		return register(upper[1] - '0'), nil
+	}
+
+	if !isOperand(rune(tok[0])) {
+		return nil, fmt.Errorf("unexpected %q in condition", tok)
+	}
+	value, err := p.s.Resolve(tok)
+	if err != nil {
+		return nil, err
+	}
+	return constant(value), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// scanCondition splits text into operands and operators.
+func scanCondition(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		ch := rune(text[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case isOperand(ch):
+			start := i
+			if i++; ch == '#' && i < len(text) && text[i] == '-' {
+				i++
+			}
+			for i < len(text) && isOperand(rune(text[i])) {
+				i++
+			}
+			tokens = append(tokens, text[start:i])
+		case i+1 < len(text) && contains([]string{"==", "!=", "<=", ">=", "&&", "||"}, text[i:i+2]):
+			tokens = append(tokens, text[i:i+2])
+			i += 2
+		default:
+			tokens = append(tokens, text[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+// isOperand reports whether ch can appear in a label, register or number.
+func isOperand(ch rune) bool {
+	return ch == '_' || ch == '#' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
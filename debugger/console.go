@@ -0,0 +1,438 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"lc3asm-parser/vm"
+)
+
+const PROMPT = "(lc3db) "
+
+// errQuit ends the console loop.
+var errQuit = errors.New("quit")
+
+type command struct {
+	names []string
+	usage string
+	help  string
+	run   func(c *console, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{[]string{"step", "s"}, "step [N]", "execute N instructions, stepping into subroutines and traps", (*console).step},
+		{[]string{"next", "n"}, "next [N]", "execute N instructions, stepping over JSR, JSRR and TRAP", (*console).next},
+		{[]string{"continue", "c"}, "continue", "run until a breakpoint or HALT", (*console).cont},
+		{[]string{"finish", "fin"}, "finish", "run until the current subroutine returns", (*console).finish},
+		{[]string{"reverse-step", "rs"}, "reverse-step [N]", "undo N instructions", (*console).reverseStep},
+		{[]string{"reverse-continue", "rc"}, "reverse-continue", "run backwards to the previous breakpoint", (*console).reverseContinue},
+		{[]string{"history"}, "history [N]", "show or set how many instructions can be undone", (*console).history},
+		{[]string{"break", "b"}, "break [LOCATION] [if COND]", "set a breakpoint, or list breakpoints; without a LOCATION stop when COND becomes true", (*console).setBreak},
+		{[]string{"watch"}, "watch LOCATION [if COND]", "stop after LOCATION is written", watch(Watch)},
+		{[]string{"rwatch"}, "rwatch LOCATION [if COND]", "stop after LOCATION is read", watch(ReadWatch)},
+		{[]string{"awatch"}, "awatch LOCATION [if COND]", "stop after LOCATION is read or written", watch(AccessWatch)},
+		{[]string{"condition"}, "condition ID [COND]", "set or remove the condition of a breakpoint", (*console).condition},
+		{[]string{"delete", "d"}, "delete [ID]", "delete a breakpoint, or all of them", (*console).delete},
+		{[]string{"registers", "regs"}, "registers", "show the registers and condition codes", (*console).registers},
+		{[]string{"x"}, "x LOCATION [N]", "examine N words of memory", (*console).examine},
+		{[]string{"set"}, "set REGISTER|LOCATION VALUE", "change a register or a word of memory", (*console).set},
+		{[]string{"where", "w"}, "where", "show the next instruction", (*console).where},
+		{[]string{"help", "h"}, "help", "show this help", (*console).help},
+		{[]string{"quit", "q"}, "quit", "leave the debugger", (*console).quit},
+	}
+}
+
+type console struct {
+	s   *Session
+	out io.Writer
+}
+
+// Start reads commands from in until quit or end of input. Pass the same
+// reader to the machine's keyboard so that a program waiting for a key
+// reads the next line typed at the prompt. An empty line repeats the
+// previous command.
+func Start(in *bufio.Reader, out io.Writer, s *Session) {
+	c := &console{s: s, out: out}
+	c.where(nil)
+
+	var last string
+	for {
+		fmt.Fprint(out, PROMPT)
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(out)
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			line = last
+		}
+		last = line
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		cmd, ok := lookup(fields[0])
+		if !ok {
+			fmt.Fprintf(out, "unknown command %q, try help\n", fields[0])
+			continue
+		}
+
+		if err := cmd.run(c, fields[1:]); err == errQuit {
+			return
+		} else if err != nil {
+			fmt.Fprintln(out, err)
+		}
+	}
+}
+
+func lookup(name string) (command, bool) {
+	for _, cmd := range commands {
+		for _, n := range cmd.names {
+			if n == name {
+				return cmd, true
+			}
+		}
+	}
+	return command{}, false
+}
+
+func (c *console) step(args []string) error {
+	return c.repeat(args, c.s.Step)
+}
+
+func (c *console) next(args []string) error {
+	return c.repeat(args, c.s.Next)
+}
+
+func (c *console) cont(args []string) error {
+	return c.report(c.s.Continue())
+}
+
+func (c *console) finish(args []string) error {
+	return c.report(c.s.Finish())
+}
+
+func (c *console) reverseStep(args []string) error {
+	return c.repeat(args, c.s.ReverseStep)
+}
+
+func (c *console) reverseContinue(args []string) error {
+	return c.report(c.s.ReverseContinue())
+}
+
+func (c *console) history(args []string) error {
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("bad history size %q", args[0])
+		}
+		c.s.HistoryLimit = n
+	}
+
+	fmt.Fprintf(c.out, "%d instructions recorded, at most %d.\n", c.s.History(), c.s.HistoryLimit)
+	fmt.Fprintln(c.out, "Keyboard input and display output are not undone.")
+	return nil
+}
+
+// repeat runs advance count times, stopping early at a breakpoint or HALT.
+func (c *console) repeat(args []string, advance func() (Stop, error)) error {
+	count := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad count %q", args[0])
+		}
+		count = n
+	}
+
+	for i := 0; i < count; i++ {
+		stop, err := advance()
+		if err != nil || stop.Reason != Stepped || i == count-1 {
+			return c.report(stop, err)
+		}
+	}
+	return nil
+}
+
+// report prints why execution stopped and where.
+func (c *console) report(stop Stop, err error) error {
+	if err != nil {
+		if errors.Is(err, vm.ErrHalted) {
+			return errors.New("the program has halted")
+		}
+		fmt.Fprintln(c.out, err)
+	}
+
+	switch stop.Reason {
+	case Halted:
+		fmt.Fprintln(c.out, "Program halted.")
+		return nil
+	case BreakpointHit:
+		bp := stop.Breakpoint
+		switch {
+		case stop.Access != nil && stop.Access.Write:
+			fmt.Fprintf(c.out, "Watchpoint %d: %s written, x%04X -> x%04X\n",
+				bp.ID, c.address(bp.Address), stop.Access.Old, stop.Access.Value)
+		case stop.Access != nil:
+			fmt.Fprintf(c.out, "Watchpoint %d: %s read, x%04X\n", bp.ID, c.address(bp.Address), stop.Access.Value)
+		case bp.Kind == When:
+			fmt.Fprintf(c.out, "Condition %d: %s\n", bp.ID, bp.Condition)
+		default:
+			fmt.Fprintf(c.out, "Breakpoint %d, %s\n", bp.ID, c.address(stop.PC))
+		}
+	case Paused:
+		fmt.Fprintln(c.out, "Paused.")
+	case HistoryStart:
+		fmt.Fprintln(c.out, "No more reverse-execution history.")
+	}
+	return c.where(nil)
+}
+
+func (c *console) setBreak(args []string) error {
+	if len(args) == 0 {
+		c.listBreakpoints()
+		return nil
+	}
+
+	args, cond, err := c.splitCondition(args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if cond == nil {
+			return errors.New("usage: break [LOCATION] [if COND]")
+		}
+		bp := c.s.When(cond)
+		fmt.Fprintf(c.out, "Condition %d: %s\n", bp.ID, cond)
+		return nil
+	}
+
+	address, err := c.s.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	bp := c.s.BreakIf(address, cond)
+	fmt.Fprintf(c.out, "Breakpoint %d at %s\n", bp.ID, c.address(address))
+	return nil
+}
+
+// watch returns the command that sets a watchpoint of the given kind.
+func watch(kind Kind) func(c *console, args []string) error {
+	return func(c *console, args []string) error {
+		args, cond, err := c.splitCondition(args)
+		if err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s LOCATION [if COND]", kind)
+		}
+
+		address, err := c.s.Resolve(args[0])
+		if err != nil {
+			return err
+		}
+		bp := c.s.WatchIf(kind, address, cond)
+		fmt.Fprintf(c.out, "Watchpoint %d: %s\n", bp.ID, c.address(address))
+		return nil
+	}
+}
+
+func (c *console) condition(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: condition ID [COND]")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	bp, ok := c.s.Breakpoint(id)
+	if err != nil || !ok {
+		return fmt.Errorf("no breakpoint %s", args[0])
+	}
+
+	if len(args) == 1 {
+		if bp.Kind == When {
+			return errors.New("a when breakpoint needs its condition")
+		}
+		c.s.SetCondition(bp, nil)
+		return nil
+	}
+
+	cond, err := ParseCondition(c.s, strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+	c.s.SetCondition(bp, cond)
+	return nil
+}
+
+// splitCondition separates a trailing "if COND" from args.
+func (c *console) splitCondition(args []string) ([]string, *Condition, error) {
+	for i, arg := range args {
+		if arg == "if" {
+			cond, err := ParseCondition(c.s, strings.Join(args[i+1:], " "))
+			return args[:i], cond, err
+		}
+	}
+	return args, nil, nil
+}
+
+func (c *console) listBreakpoints() {
+	bps := c.s.Breakpoints()
+	if len(bps) == 0 {
+		fmt.Fprintln(c.out, "No breakpoints.")
+	}
+
+	for _, bp := range bps {
+		fmt.Fprintf(c.out, "%-3d %-7s", bp.ID, bp.Kind)
+		if bp.Kind != When {
+			fmt.Fprintf(c.out, "%s", c.address(bp.Address))
+			if bp.Condition != nil {
+				fmt.Fprint(c.out, "  if ")
+			}
+		}
+		if bp.Condition != nil {
+			fmt.Fprint(c.out, bp.Condition)
+		}
+		fmt.Fprintln(c.out)
+	}
+}
+
+func (c *console) delete(args []string) error {
+	if len(args) == 0 {
+		c.s.ClearBreakpoints()
+		return nil
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil || !c.s.Delete(id) {
+		return fmt.Errorf("no breakpoint %s", args[0])
+	}
+	return nil
+}
+
+func (c *console) registers(args []string) error {
+	m := c.s.Machine
+	for i, r := range m.Registers {
+		sep := "  "
+		if i%4 == 3 {
+			sep = "\n"
+		}
+		fmt.Fprintf(c.out, "R%d x%04X%s", i, r, sep)
+	}
+
+	mode := "user"
+	if m.Supervisor() {
+		mode = "supervisor"
+	}
+	fmt.Fprintf(c.out, "PC x%04X  PSR x%04X  CC %s  (%s, priority %d)\n",
+		m.PC, m.PSR, condition(m.Cond()), mode, m.Priority())
+	return nil
+}
+
+func (c *console) examine(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: x LOCATION [N]")
+	}
+
+	address, err := c.s.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	count := 1
+	if len(args) > 1 {
+		if count, err = strconv.Atoi(args[1]); err != nil || count < 1 {
+			return fmt.Errorf("bad count %q", args[1])
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		value := c.s.Machine.Memory[address]
+		fmt.Fprintf(c.out, "%-20s x%04X  %6d\n", c.address(address), value, int16(value))
+		address++
+	}
+	return nil
+}
+
+func (c *console) set(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: set REGISTER|LOCATION VALUE")
+	}
+
+	value, err := c.s.Resolve(args[1])
+	if err != nil {
+		return err
+	}
+
+	m := c.s.Machine
+	target := strings.ToUpper(args[0])
+	switch {
+	case target == "PC":
+		m.PC = value
+	case target == "PSR":
+		m.PSR = value
+	case len(target) == 2 && target[0] == 'R' && target[1] >= '0' && target[1] <= '7':
+		m.Registers[target[1]-'0'] = value
+	default:
+		address, err := c.s.Resolve(args[0])
+		if err != nil {
+			return err
+		}
+		m.Memory[address] = value
+	}
+	return nil
+}
+
+// where prints the instruction at the PC.
+func (c *console) where(args []string) error {
+	pc := c.s.Machine.PC
+	fmt.Fprintf(c.out, "%-20s x%04X", c.address(pc), c.s.Machine.Memory[pc])
+	if line, text, ok := c.s.Source(pc); ok {
+		fmt.Fprintf(c.out, "  %4d: %s", line, text)
+	}
+	fmt.Fprintln(c.out)
+	return nil
+}
+
+func (c *console) help(args []string) error {
+	for _, cmd := range commands {
+		fmt.Fprintf(c.out, "%-30s %s\n", cmd.usage, cmd.help)
+	}
+	fmt.Fprintln(c.out, "LOCATION is a label or an address such as x3000; an empty line repeats the last command.")
+	return nil
+}
+
+func (c *console) quit(args []string) error {
+	return errQuit
+}
+
+// address formats address with its label, as x3002 <LOOP>.
+func (c *console) address(address uint16) string {
+	if label := c.s.Label(address); label != "" {
+		return fmt.Sprintf("x%04X <%s>", address, label)
+	}
+	return fmt.Sprintf("x%04X", address)
+}
+
+func condition(cc uint16) string {
+	switch cc {
+	case vm.FlagN:
+		return "N"
+	case vm.FlagZ:
+		return "Z"
+	case vm.FlagP:
+		return "P"
+	}
+	return "?"
+}
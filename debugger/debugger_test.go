@@ -0,0 +1,419 @@
+package debugger
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/vm"
+)
+
+const program = `.ORIG x3000
+	AND R0,R0,#0
+	ADD R1,R0,#3
+LOOP	ADD R0,R0,R1
+	ADD R1,R1,#-1
+	BRp LOOP
+	JSR DOUBLE
+	ST R0, RESULT
+	HALT
+DOUBLE	ST R7, SAVE7
+	ADD R0,R0,R0
+	JSR INC
+	LD R7, SAVE7
+	RET
+INC	ADD R0,R0,#1
+	RET
+SAVE7	.BLKW 1
+RESULT	.BLKW 1
+.END`
+
+func TestResolve(t *testing.T) {
+	s := newSession(t, program)
+
+	tests := []struct {
+		expr     string
+		expected uint16
+	}{
+		{"LOOP", 0x3002},
+		{"RESULT", 0x3010},
+		{"x3004", 0x3004},
+		{"0x3004", 0x3004},
+		{"#12", 12},
+		{"12", 12},
+		{"-1", 0xFFFF},
+		{"TRAP_HALT", s.Machine.Memory[0x25]},
+	}
+
+	for i, tt := range tests {
+		address, err := s.Resolve(tt.expr)
+		if err != nil {
+			t.Errorf("tests[%d] - %s", i, err)
+			continue
+		}
+		if address != tt.expected {
+			t.Errorf("tests[%d] - %q wrong. expected=x%04X, got=x%04X", i, tt.expr, tt.expected, address)
+		}
+	}
+
+	if _, err := s.Resolve("NOWHERE"); err == nil {
+		t.Errorf("expected error resolving NOWHERE")
+	}
+}
+
+func TestLabel(t *testing.T) {
+	s := newSession(t, program)
+
+	tests := []struct {
+		address  uint16
+		expected string
+	}{
+		{0x3000, ""},
+		{0x3002, "LOOP"},
+		{0x3004, "LOOP+2"},
+		{0x300A, "DOUBLE+2"},
+		{0x4000, ""},
+		{s.Machine.Memory[0x25], "TRAP_HALT"},
+	}
+
+	for i, tt := range tests {
+		if label := s.Label(tt.address); label != tt.expected {
+			t.Errorf("tests[%d] - label of x%04X wrong. expected=%q, got=%q", i, tt.address, tt.expected, label)
+		}
+	}
+
+	line, text, ok := s.Source(0x3002)
+	if !ok || line != 4 || text != "LOOP\tADD R0,R0,R1" {
+		t.Errorf("source wrong. got=%d %q %t", line, text, ok)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	s := newSession(t, program)
+	bp := s.Break(0x3002)
+
+	// The loop body runs three times
+	for i := 0; i < 3; i++ {
+		stop := expectStop(t, s.Continue, BreakpointHit, 0x3002)
+		if stop.Breakpoint != bp {
+			t.Errorf("continue %d - wrong breakpoint %v", i, stop.Breakpoint)
+		}
+	}
+
+	if !s.Delete(bp.ID) || s.Delete(bp.ID) {
+		t.Errorf("delete wrong")
+	}
+	if stop, err := s.Continue(); err != nil || stop.Reason != Halted {
+		t.Fatalf("program did not halt. got=%d %v", stop.Reason, err)
+	}
+
+	if s.Machine.Memory[0x3010] != 13 {
+		t.Errorf("RESULT wrong. expected=13, got=%d", s.Machine.Memory[0x3010])
+	}
+}
+
+func TestNextAndFinish(t *testing.T) {
+	s := newSession(t, program)
+	s.Break(0x3005)
+	expectStop(t, s.Continue, BreakpointHit, 0x3005)
+
+	// Step over JSR DOUBLE, which itself calls INC
+	expectStop(t, s.Next, Stepped, 0x3006)
+	if s.Machine.Registers[0] != 13 {
+		t.Errorf("R0 wrong after next. expected=13, got=%d", s.Machine.Registers[0])
+	}
+
+	// The recursive call returns to x3009 twice; only the second return
+	// ends the call being stepped over
+	s = newSession(t, `.ORIG x3000
+	ADD R0,R0,#3
+	LEA R6, STACK
+	JSR REC
+	HALT
+REC	ADD R0,R0,#-1
+	BRz DONE
+	ADD R6,R6,#-1
+	STR R7,R6,#0
+	JSR REC
+	LDR R7,R6,#0
+	ADD R6,R6,#1
+DONE	ADD R1,R1,#1
+	RET
+	.BLKW 4
+STACK	.END`)
+	s.Break(0x3008)
+	expectStop(t, s.Continue, BreakpointHit, 0x3008)
+	s.ClearBreakpoints()
+	expectStop(t, s.Next, Stepped, 0x3009)
+	if s.Machine.Registers[1] != 2 {
+		t.Errorf("next stopped in a deeper call. expected R1=2, got=%d", s.Machine.Registers[1])
+	}
+
+	// A keyboard interrupt is pending when next is given at the JSR; the
+	// handler and the call both run through
+	s = newSession(t, `.ORIG x3000
+	LD R6, USER_STACK
+	LD R1, HANDLER
+	STI R1, KBD_VECTOR
+	LD R1, ENABLE
+	STI R1, KBSR_ADDR
+	JSR SUB
+	HALT
+SUB	ADD R2, R2, #1
+	RET
+ISR	LDI R3, KBDR_ADDR
+	AND R5, R5, #0
+	STI R5, KBSR_ADDR
+	RTI
+USER_STACK	.FILL #16384
+HANDLER	.FILL ISR
+KBD_VECTOR	.FILL #384
+ENABLE	.FILL #16384
+KBSR_ADDR	.FILL #-512
+KBDR_ADDR	.FILL #-510
+.END`)
+	s.Machine.AttachConsole(strings.NewReader("k"), io.Discard)
+	s.Break(0x3005)
+	expectStop(t, s.Continue, BreakpointHit, 0x3005)
+	s.ClearBreakpoints()
+	expectStop(t, s.Next, Stepped, 0x3006)
+	if s.Machine.Registers[2] != 1 || s.Machine.Registers[3] != 'k' {
+		t.Errorf("next did not run the handler and the call. R2=%d, R3=%d", s.Machine.Registers[2], s.Machine.Registers[3])
+	}
+
+	s = newSession(t, program)
+	s.Break(0x300D)
+	expectStop(t, s.Continue, BreakpointHit, 0x300D)
+	expectStop(t, s.Finish, Stepped, 0x300B)
+	expectStop(t, s.Finish, Stepped, 0x3006)
+
+	// Stepping into a trap enters the operating system
+	expectStop(t, s.Step, Stepped, 0x3007)
+	expectStop(t, s.Step, Stepped, s.Machine.Memory[0x25])
+	if s.Label(s.Machine.PC) != "TRAP_HALT" {
+		t.Errorf("step did not enter TRAP_HALT")
+	}
+}
+
+func TestConditions(t *testing.T) {
+	s := newSession(t, program)
+	m := s.Machine
+	m.Registers[3] = 0
+	m.Registers[4] = 0xFFFF
+	m.PC = 0x3002
+	m.Memory[0x3010] = 7
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"R3 == x0000 && PC == LOOP", true},
+		{"r3 == 0 && pc == DOUBLE", false},
+		{"R4 == #-1", true},
+		{"R4 > 0 || R3 != 0", true},
+		{"!(R3 == 0)", false},
+		{"[RESULT] == 7", true},
+		{"[LOOP + 14] >= 7 && [RESULT] < 8", true},
+		{"PC - LOOP == 0", true},
+		{"-R4 == 1", true},
+	}
+
+	for i, tt := range tests {
+		cond, err := ParseCondition(s, tt.input)
+		if err != nil {
+			t.Errorf("tests[%d] - %s", i, err)
+			continue
+		}
+		if cond.Eval(s) != tt.expected {
+			t.Errorf("tests[%d] - %q wrong. expected=%t", i, tt.input, tt.expected)
+		}
+	}
+
+	errors := []string{"R3 ==", "NOWHERE == 1", "(R3 == 0", "R3 == 0 )", "R3 $ 1"}
+	for i, input := range errors {
+		if _, err := ParseCondition(s, input); err == nil {
+			t.Errorf("errors[%d] - expected error parsing %q", i, input)
+		}
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	s := newSession(t, program)
+	write := s.Watch(Watch, 0x3010)
+	read := s.Watch(ReadWatch, 0x300F)
+
+	stop := expectStop(t, s.Continue, BreakpointHit, 0x300C)
+	if stop.Breakpoint != read || stop.Access == nil || stop.Access.Write {
+		t.Errorf("expected read of SAVE7, got=%+v", stop)
+	}
+
+	stop = expectStop(t, s.Continue, BreakpointHit, 0x3007)
+	if stop.Breakpoint != write || stop.Access.Value != 13 || stop.Access.Old != 0 {
+		t.Errorf("expected write of RESULT, got=%+v %+v", stop, stop.Access)
+	}
+
+	// A condition stops only when it becomes true
+	s = newSession(t, program)
+	cond, err := ParseCondition(s, "R1 == 1 || R1 == 2")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	when := s.When(cond)
+	stop = expectStop(t, s.Continue, BreakpointHit, 0x3004)
+	if stop.Breakpoint != when || s.Machine.Registers[1] != 2 {
+		t.Errorf("condition stopped at R1=%d", s.Machine.Registers[1])
+	}
+	if stop, _ := s.Continue(); stop.Reason != Halted {
+		t.Errorf("condition fired again while still true")
+	}
+
+	// A conditional breakpoint is skipped while its condition is false
+	s = newSession(t, program)
+	bp := s.Break(0x3002)
+	if bp.Condition, err = ParseCondition(s, "R1 == 1"); err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	expectStop(t, s.Continue, BreakpointHit, 0x3002)
+	if s.Machine.Registers[1] != 1 {
+		t.Errorf("conditional breakpoint stopped at R1=%d", s.Machine.Registers[1])
+	}
+}
+
+func TestReverse(t *testing.T) {
+	s := newSession(t, program)
+	m := s.Machine
+	start := m.State()
+
+	loop := s.Break(0x3002)
+	expectStop(t, s.Continue, BreakpointHit, 0x3002)
+	expectStop(t, s.Continue, BreakpointHit, 0x3002)
+	s.Delete(loop.ID)
+	if stop, _ := s.Continue(); stop.Reason != Halted {
+		t.Fatalf("program did not halt")
+	}
+
+	// Undo the write to RESULT by running back to it
+	s.Watch(Watch, 0x3010)
+	expectStop(t, s.ReverseContinue, BreakpointHit, 0x3006)
+	if m.Halted() || m.Memory[0x3010] != 0 || m.Registers[0] != 13 {
+		t.Errorf("ST not undone. halted=%t, RESULT=%d, R0=%d", m.Halted(), m.Memory[0x3010], m.Registers[0])
+	}
+
+	// Undoing JSR DOUBLE's RET returns into the subroutine, and the pushed
+	// SAVE7 is restored with it
+	expectStop(t, s.ReverseStep, Stepped, 0x300C)
+	s.Break(0x3002)
+	expectStop(t, s.ReverseContinue, BreakpointHit, 0x3002)
+	if m.Registers[0] != 5 || m.Memory[0x300F] != 0 {
+		t.Errorf("state wrong at LOOP. R0=%d, SAVE7=x%04X", m.Registers[0], m.Memory[0x300F])
+	}
+
+	for _, r0 := range []uint16{3, 0} {
+		if stop, _ := s.ReverseContinue(); stop.Reason != BreakpointHit || m.Registers[0] != r0 {
+			t.Errorf("expected loop breakpoint with R0=%d, got=%+v R0=%d", r0, stop, m.Registers[0])
+		}
+	}
+	if stop, _ := s.ReverseContinue(); stop.Reason != HistoryStart || m.State() != start {
+		t.Errorf("expected start of history, got=%+v", stop)
+	}
+
+	// Forward execution records again from here
+	expectStop(t, s.Step, Stepped, 0x3001)
+	if s.History() != 1 {
+		t.Errorf("history wrong. expected=1, got=%d", s.History())
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	s := newSession(t, program)
+	s.HistoryLimit = 3
+
+	for i := 0; i < 4; i++ {
+		expectStop(t, s.Step, Stepped, uint16(0x3001+i))
+	}
+	if s.History() != 3 {
+		t.Fatalf("history wrong. expected=3, got=%d", s.History())
+	}
+
+	expectStop(t, s.ReverseStep, Stepped, 0x3003)
+	expectStop(t, s.ReverseStep, Stepped, 0x3002)
+	expectStop(t, s.ReverseStep, Stepped, 0x3001)
+	if stop, _ := s.ReverseStep(); stop.Reason != HistoryStart || stop.PC != 0x3001 {
+		t.Errorf("expected start of history at x3001, got=%+v", stop)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	s := newSession(t, program)
+	script := strings.Join([]string{
+		"break LOOP",
+		"continue",
+		"",
+		"registers",
+		"x RESULT",
+		"set RESULT x10",
+		"x RESULT",
+		"set R3 LOOP",
+		"delete",
+		"break",
+		"next 3",
+		"bogus",
+		"continue",
+		"quit",
+	}, "\n")
+
+	var out strings.Builder
+	Start(bufio.NewReader(strings.NewReader(script)), &out, s)
+
+	expected := []string{
+		"x3000                x5020     2: AND R0,R0,#0",
+		"Breakpoint 1 at x3002 <LOOP>",
+		"Breakpoint 1, x3002 <LOOP>\nx3002 <LOOP>         x1001     4: LOOP\tADD R0,R0,R1",
+		"R0 x0003  R1 x0002",
+		"PC x3002  PSR x8001  CC P  (user, priority 0)",
+		"x3010 <RESULT>       x0000       0",
+		"x3010 <RESULT>       x0010      16",
+		"No breakpoints.",
+		`unknown command "bogus"`,
+		"Program halted.",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("output missing %q:\n%s", e, out.String())
+		}
+	}
+
+	if s.Machine.Registers[3] != 0x3002 {
+		t.Errorf("set R3 wrong. got=x%04X", s.Machine.Registers[3])
+	}
+}
+
+func newSession(t *testing.T, source string) *Session {
+	t.Helper()
+
+	obj, err := assembler.Assemble(source)
+	if err != nil {
+		t.Fatalf("assembly failed:\n%s", err)
+	}
+
+	m := vm.New()
+	m.LoadImage(obj.Origin, obj.Code)
+	m.PC = obj.Origin
+	m.AttachConsole(nil, io.Discard)
+	return New(m, obj, source)
+}
+
+func expectStop(t *testing.T, advance func() (Stop, error), reason Reason, pc uint16) Stop {
+	t.Helper()
+
+	stop, err := advance()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stop.Reason != reason || stop.PC != pc {
+		t.Fatalf("stop wrong. expected=%d at x%04X, got=%d at x%04X", reason, pc, stop.Reason, stop.PC)
+	}
+	return stop
+}
@@ -0,0 +1,518 @@
+// Package debugger drives a vm.Machine on behalf of a user interface:
+// stepping, stopping at breakpoints and resolving addresses through the
+// assembler's symbol tables, so that users can type LOOP instead of x3002.
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/lc3os"
+	"lc3asm-parser/vm"
+)
+
+// Reason says why execution stopped.
+type Reason int
+
+const (
+	Stepped Reason = iota
+	BreakpointHit
+	Halted
+	Paused
+	HistoryStart // Reverse execution ran out of recorded history
+)
+
+// DefaultHistory is the number of instructions recorded for reverse
+// execution by a new session.
+const DefaultHistory = 100000
+
+// Stop describes where and why execution stopped.
+type Stop struct {
+	Reason     Reason
+	PC         uint16
+	Breakpoint *Breakpoint // The breakpoint hit, if any
+	Access     *vm.Access  // The access that triggered a watchpoint
+}
+
+// Kind selects what a breakpoint stops on.
+type Kind int
+
+const (
+	Break       Kind = iota // Before the instruction at Address
+	Watch                   // After a write to Address
+	ReadWatch               // After a read of Address
+	AccessWatch             // After a read or write of Address
+	When                    // When the condition becomes true
+)
+
+var kindNames = map[Kind]string{
+	Break:       "break",
+	Watch:       "watch",
+	ReadWatch:   "rwatch",
+	AccessWatch: "awatch",
+	When:        "when",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Breakpoint stops execution. A Condition, when set, must also hold; for
+// When breakpoints it is the only trigger.
+type Breakpoint struct {
+	ID        int
+	Kind      Kind
+	Address   uint16
+	Condition *Condition
+
+	held bool // The When condition held after the previous instruction
+}
+
+// matches reports whether the watchpoint bp is triggered by a.
+func (bp *Breakpoint) matches(a vm.Access) bool {
+	if a.Address != bp.Address {
+		return false
+	}
+	switch bp.Kind {
+	case Watch:
+		return a.Write
+	case ReadWatch:
+		return !a.Write
+	case AccessWatch:
+		return true
+	}
+	return false
+}
+
+// Session is a program loaded into a machine under the debugger's control.
+type Session struct {
+	Machine *vm.Machine
+
+	images []*image
+	paused atomic.Bool
+
+	// Breakpoints may be changed from another goroutine while the
+	// program runs
+	mu          sync.Mutex
+	breakpoints []*Breakpoint
+	nextID      int
+
+	// HistoryLimit bounds the instructions that can be undone; zero turns
+	// recording off. Each costs a register snapshot plus its accesses.
+	HistoryLimit int
+
+	accesses []vm.Access // Made by the instruction being executed
+	last     vm.Trace    // The instruction executed last, without its writes
+	history  []record
+}
+
+// record is what an executed instruction changed: the processor state
+// before it, and its accesses, whose writes to memory can be undone.
+// Device accesses such as keyboard input and display output cannot.
+type record struct {
+	state    vm.State
+	accesses []vm.Access
+}
+
+// image is an object loaded into the machine, with the source it was
+// assembled from when that is known.
+type image struct {
+	obj   *assembler.Object
+	lines []string
+}
+
+// New starts a session on m. The program's symbols and source are used to
+// resolve and describe addresses; obj may be nil for programs loaded
+// without them. The operating system's symbols are always available.
+func New(m *vm.Machine, obj *assembler.Object, source string) *Session {
+	s := &Session{Machine: m, nextID: 1, HistoryLimit: DefaultHistory}
+	m.OnAccess = func(a vm.Access) {
+		s.accesses = append(s.accesses, a)
+	}
+	trace := m.OnTrace
+	m.OnTrace = func(t vm.Trace) {
+		if trace != nil {
+			trace(t)
+		}
+		t.Writes = nil
+		s.last = t
+	}
+	if obj != nil {
+		s.addImage(obj, source)
+	}
+	s.addImage(lc3os.Image(), lc3os.Source)
+	return s
+}
+
+func (s *Session) addImage(obj *assembler.Object, source string) {
+	img := &image{obj: obj}
+	if source != "" {
+		img.lines = strings.Split(source, "\n")
+	}
+	s.images = append(s.images, img)
+}
+
+// Resolve returns the address named by expr: a label or a number written
+// as x3000, #12288 or 12288.
+func (s *Session) Resolve(expr string) (uint16, error) {
+	for _, img := range s.images {
+		if sym, ok := img.obj.Symbols.Resolve(expr); ok {
+			return sym.Address, nil
+		}
+	}
+
+	if value, ok := parseNumber(expr); ok {
+		return value, nil
+	}
+	return 0, fmt.Errorf("no label or address %q", expr)
+}
+
+// Label describes address relative to the nearest label at or before it,
+// such as LOOP or LOOP+2. It returns "" for addresses outside any image.
+func (s *Session) Label(address uint16) string {
+	for _, img := range s.images {
+		if !img.contains(address) {
+			continue
+		}
+
+		var nearest *assembler.Symbol
+		for _, sym := range img.obj.Symbols.Symbols() {
+			if sym.Address <= address && (nearest == nil || sym.Address > nearest.Address) {
+				nearest = sym
+			}
+		}
+		if nearest == nil {
+			return ""
+		}
+		if nearest.Address == address {
+			return nearest.Name
+		}
+		return fmt.Sprintf("%s+%d", nearest.Name, address-nearest.Address)
+	}
+	return ""
+}
+
+// Source returns the line number and text of the statement that assembled
+// to address, if the source is known.
+func (s *Session) Source(address uint16) (int, string, bool) {
+	for _, img := range s.images {
+		l, ok := img.obj.Lines.Lookup(address)
+		if !ok || img.lines == nil || l.Line > len(img.lines) {
+			continue
+		}
+		return l.Line, strings.TrimSpace(img.lines[l.Line-1]), true
+	}
+	return 0, "", false
+}
+
+func (img *image) contains(address uint16) bool {
+	return address >= img.obj.Origin && int(address) < int(img.obj.Origin)+len(img.obj.Code)
+}
+
+// Break sets a breakpoint at address.
+func (s *Session) Break(address uint16) *Breakpoint {
+	return s.BreakIf(address, nil)
+}
+
+// BreakIf sets a breakpoint at address that only stops when cond holds.
+// Unlike setting Condition afterwards, it is safe while the program runs.
+func (s *Session) BreakIf(address uint16, cond *Condition) *Breakpoint {
+	return s.add(&Breakpoint{Kind: Break, Address: address, Condition: cond})
+}
+
+// Watch sets a watchpoint of the given kind on the word at address.
+func (s *Session) Watch(kind Kind, address uint16) *Breakpoint {
+	return s.WatchIf(kind, address, nil)
+}
+
+// WatchIf sets a watchpoint like Watch that only stops when cond holds.
+func (s *Session) WatchIf(kind Kind, address uint16, cond *Condition) *Breakpoint {
+	return s.add(&Breakpoint{Kind: kind, Address: address, Condition: cond})
+}
+
+// SetCondition replaces the condition of bp; nil removes it. Like BreakIf,
+// it is safe while the program runs.
+func (s *Session) SetCondition(bp *Breakpoint, cond *Condition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bp.Condition = cond
+}
+
+// When sets a breakpoint that stops as soon as cond becomes true.
+func (s *Session) When(cond *Condition) *Breakpoint {
+	return s.add(&Breakpoint{Kind: When, Condition: cond, held: cond.Eval(s)})
+}
+
+func (s *Session) add(bp *Breakpoint) *Breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bp.ID = s.nextID
+	s.nextID++
+	s.breakpoints = append(s.breakpoints, bp)
+	return bp
+}
+
+// Delete removes the breakpoint with the given ID.
+func (s *Session) Delete(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, bp := range s.breakpoints {
+		if bp.ID == id {
+			s.breakpoints = append(s.breakpoints[:i], s.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBreakpoints removes every breakpoint.
+func (s *Session) ClearBreakpoints() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakpoints = nil
+}
+
+// Breakpoints returns the breakpoints in the order they were set.
+func (s *Session) Breakpoints() []*Breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Breakpoint(nil), s.breakpoints...)
+}
+
+// Breakpoint returns the breakpoint with the given ID.
+func (s *Session) Breakpoint(id int) (*Breakpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bp := range s.breakpoints {
+		if bp.ID == id {
+			return bp, true
+		}
+	}
+	return nil, false
+}
+
+// triggered returns the first breakpoint triggered by the instruction just
+// executed, with the access that triggered it for watchpoints. Every When
+// breakpoint is re-evaluated so that it only fires on a change.
+func (s *Session) triggered() (*Breakpoint, *vm.Access) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var hit *Breakpoint
+	var access *vm.Access
+
+	for _, bp := range s.breakpoints {
+		switch bp.Kind {
+		case Break:
+			if hit == nil && bp.Address == s.Machine.PC && s.holds(bp) {
+				hit = bp
+			}
+		case When:
+			held := bp.held
+			bp.held = bp.Condition.Eval(s)
+			if hit == nil && bp.held && !held {
+				hit = bp
+			}
+		default:
+			for _, a := range s.accesses {
+				if hit == nil && bp.matches(a) && s.holds(bp) {
+					hit, access = bp, &a
+				}
+			}
+		}
+	}
+	return hit, access
+}
+
+func (s *Session) holds(bp *Breakpoint) bool {
+	return bp.Condition == nil || bp.Condition.Eval(s)
+}
+
+// Pause asks a running Continue, Next or Finish to stop after the current
+// instruction. It is safe to call from another goroutine.
+func (s *Session) Pause() {
+	s.paused.Store(true)
+}
+
+// Step executes one instruction.
+func (s *Session) Step() (Stop, error) {
+	return s.run(func(vm.Trace) bool { return true })
+}
+
+// Next executes one instruction, running JSR, JSRR and TRAP through to
+// the instruction after them. Calls and returns are counted, so a
+// recursive call passing the same return address does not stop early,
+// and an interrupt serviced on the way is run through as well.
+func (s *Session) Next() (Stop, error) {
+	depth := 0
+	ran := false
+	return s.run(func(t vm.Trace) bool {
+		if t.Interrupt {
+			depth++
+		}
+		ran = ran || depth == 0
+		depth += depthChange(t)
+		return ran && depth == 0
+	})
+}
+
+// Finish runs until the current subroutine, trap or interrupt handler
+// returns.
+func (s *Session) Finish() (Stop, error) {
+	depth := 0
+	return s.run(func(t vm.Trace) bool {
+		if t.Interrupt {
+			depth++
+		}
+		depth += depthChange(t)
+		return depth < 0
+	})
+}
+
+// Continue runs until a breakpoint is reached or the machine halts.
+func (s *Session) Continue() (Stop, error) {
+	return s.run(nil)
+}
+
+// run executes instructions until done reports true for the instruction
+// just executed, a breakpoint is reached or the machine halts. An
+// exception stops execution with the error.
+func (s *Session) run(done func(t vm.Trace) bool) (Stop, error) {
+	m := s.Machine
+	s.paused.Store(false)
+
+	for {
+		state := m.State()
+		s.accesses = nil
+		err := m.Step()
+		s.record(state)
+		if err != nil {
+			return Stop{Reason: Stepped, PC: m.PC}, err
+		}
+
+		if m.Halted() {
+			return Stop{Reason: Halted, PC: m.PC}, nil
+		}
+
+		// Arriving at a breakpoint by stepping is not reported as a hit,
+		// but watchpoints and conditions are
+		finished := done != nil && done(s.last)
+		if bp, access := s.triggered(); bp != nil && !(finished && bp.Kind == Break) {
+			return Stop{Reason: BreakpointHit, PC: m.PC, Breakpoint: bp, Access: access}, nil
+		}
+		if finished {
+			return Stop{Reason: Stepped, PC: m.PC}, nil
+		}
+		if s.paused.Swap(false) {
+			return Stop{Reason: Paused, PC: m.PC}, nil
+		}
+	}
+}
+
+// record remembers the instruction just executed, forgetting the oldest
+// once HistoryLimit is reached.
+func (s *Session) record(state vm.State) {
+	if s.HistoryLimit <= 0 {
+		s.history = nil
+		return
+	}
+
+	s.history = append(s.history, record{state, s.accesses})
+	if len(s.history) > s.HistoryLimit {
+		s.history = s.history[len(s.history)-s.HistoryLimit:]
+	}
+}
+
+// History returns the number of instructions that can be undone.
+func (s *Session) History() int {
+	return len(s.history)
+}
+
+// ReverseStep undoes the last instruction executed.
+func (s *Session) ReverseStep() (Stop, error) {
+	return s.reverse(true)
+}
+
+// ReverseContinue undoes instructions until a breakpoint is reached or
+// the recorded history runs out. Watchpoints stop on the instruction that
+// made the access.
+func (s *Session) ReverseContinue() (Stop, error) {
+	return s.reverse(false)
+}
+
+func (s *Session) reverse(once bool) (Stop, error) {
+	m := s.Machine
+	s.paused.Store(false)
+
+	for len(s.history) > 0 {
+		rec := s.history[len(s.history)-1]
+		s.history = s.history[:len(s.history)-1]
+
+		for i := len(rec.accesses) - 1; i >= 0; i-- {
+			if a := rec.accesses[i]; a.Write && !a.Device {
+				m.Memory[a.Address] = a.Old
+			}
+		}
+		m.Restore(rec.state)
+		s.accesses = rec.accesses
+
+		if bp, access := s.triggered(); bp != nil && !(once && bp.Kind == Break) {
+			return Stop{Reason: BreakpointHit, PC: m.PC, Breakpoint: bp, Access: access}, nil
+		}
+		if once {
+			return Stop{Reason: Stepped, PC: m.PC}, nil
+		}
+		if s.paused.Swap(false) {
+			return Stop{Reason: Paused, PC: m.PC}, nil
+		}
+	}
+	return Stop{Reason: HistoryStart, PC: m.PC}, nil
+}
+
+// isCall reports whether instr is JSR, JSRR or TRAP.
+func isCall(instr uint16) bool {
+	op := instr >> 12
+	return op == 0x4 || op == 0xF
+}
+
+// depthChange returns how the instruction in t changed the call depth: up
+// for a call or an exception it raised, down for a return. An interrupt
+// serviced before it is left to the caller.
+func depthChange(t vm.Trace) int {
+	switch {
+	case t.Exception, isCall(t.Instruction):
+		return 1
+	case isReturn(t.Instruction):
+		return -1
+	}
+	return 0
+}
+
+// isReturn reports whether instr is RET or RTI.
+func isReturn(instr uint16) bool {
+	return instr == 0xC1C0 || instr>>12 == 0x8
+}
+
+// parseNumber parses x3000, #12288 or 12288, with an optional minus sign,
+// as a 16-bit word.
+func parseNumber(s string) (uint16, bool) {
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "x") || strings.HasPrefix(s, "X"):
+		base, s = 16, s[1:]
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(s, "#"):
+		s = s[1:]
+	}
+
+	value, err := strconv.ParseInt(s, base, 32)
+	if err != nil || value < -32768 || value > 0xFFFF {
+		return 0, false
+	}
+	return uint16(value), true
+}
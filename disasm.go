@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/disasm"
+)
+
+// disassemble implements `disasm [-sym file.sym] [-o out.asm] file.obj`.
+func disassemble(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	out := fs.String("o", "", "source file to write (default: standard output)")
+	sym := fs.String("sym", "", "symbol table to name addresses from (default: the .sym next to the object, if any)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: disasm [-sym file.sym] [-o out.asm] file.obj")
+	}
+	obj, err := readObject(fs.Arg(0), *sym)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return disasm.WriteSource(os.Stdout, obj)
+	}
+	return writeFile(*out, func(w io.Writer) error {
+		return disasm.WriteSource(w, obj)
+	})
+}
+
+// readObject reads the object file at path with the symbols in symPath,
+// or in the .sym next to the object when symPath is empty and there is
+// one.
+func readObject(path, symPath string) (*assembler.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	obj, err := assembler.ReadObject(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if symPath == "" {
+		if _, err := os.Stat(replaceExt(path, ".sym")); err == nil {
+			symPath = replaceExt(path, ".sym")
+		}
+	}
+	if symPath != "" {
+		sf, err := os.Open(symPath)
+		if err != nil {
+			return nil, err
+		}
+		defer sf.Close()
+
+		if obj.Symbols, err = assembler.ReadSymbols(sf); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
@@ -0,0 +1,187 @@
+// Package disasm turns LC-3 machine code back into assembly using the
+// mnemonics the lexer recognizes, so that its output can be assembled
+// again.
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/token"
+)
+
+// Labels names addresses. ok is false for an address without a label.
+type Labels func(address uint16) (name string, ok bool)
+
+// SymbolLabels names addresses after the symbols in tables. When several
+// symbols share an address the first one defined wins.
+func SymbolLabels(tables ...*assembler.SymbolTable) Labels {
+	names := make(map[uint16]string)
+	for _, st := range tables {
+		for _, sym := range st.Symbols() {
+			if _, ok := names[sym.Address]; !ok {
+				names[sym.Address] = sym.Name
+			}
+		}
+	}
+
+	return func(address uint16) (string, bool) {
+		name, ok := names[address]
+		return name, ok
+	}
+}
+
+// Instruction is a decoded instruction word.
+type Instruction struct {
+	Address  uint16
+	Word     uint16
+	Mnemonic string
+	Operands []string // Operands other than a PC-relative target
+
+	// Target is the address a PC-relative operand refers to
+	Target    uint16
+	HasTarget bool
+}
+
+// Decode decodes the word stored at address. ok is false for words the
+// assembler never produces: the reserved opcode, a BR without condition
+// bits and encodings with nonzero unused bits.
+func Decode(address, word uint16) (Instruction, bool) {
+	inst := Instruction{Address: address, Word: word}
+	dr := register(word >> 9)
+	sr1 := register(word >> 6)
+
+	switch word >> 12 {
+	case 0x0: // BR
+		flags := ""
+		for i, flag := range "nzp" {
+			if word&(0x800>>i) != 0 {
+				flags += string(flag)
+			}
+		}
+		if flags == "" {
+			return inst, false
+		}
+		inst.Mnemonic = "BR" + flags
+		inst.target(word, 9)
+	case 0x1, 0x5: // ADD, AND
+		inst.Mnemonic = map[uint16]string{0x1: "ADD", 0x5: "AND"}[word>>12]
+		switch {
+		case word&0x20 != 0:
+			inst.Operands = []string{dr, sr1, fmt.Sprintf("#%d", int16(signExtend(word, 5)))}
+		case word&0x18 == 0:
+			inst.Operands = []string{dr, sr1, register(word)}
+		default:
+			return inst, false
+		}
+	case 0x2, 0x3, 0xA, 0xB, 0xE: // LD, ST, LDI, STI, LEA
+		inst.Mnemonic = map[uint16]string{0x2: "LD", 0x3: "ST", 0xA: "LDI", 0xB: "STI", 0xE: "LEA"}[word>>12]
+		inst.Operands = []string{dr}
+		inst.target(word, 9)
+	case 0x4: // JSR, JSRR
+		if word&0x800 != 0 {
+			inst.Mnemonic = "JSR"
+			inst.target(word, 11)
+		} else if word&0x63F == 0 {
+			inst.Mnemonic = "JSRR"
+			inst.Operands = []string{sr1}
+		} else {
+			return inst, false
+		}
+	case 0x6, 0x7: // LDR, STR
+		inst.Mnemonic = map[uint16]string{0x6: "LDR", 0x7: "STR"}[word>>12]
+		inst.Operands = []string{dr, sr1, fmt.Sprintf("#%d", int16(signExtend(word, 6)))}
+	case 0x8: // RTI
+		if word != 0x8000 {
+			return inst, false
+		}
+		inst.Mnemonic = "RTI"
+	case 0x9: // NOT
+		if word&0x3F != 0x3F {
+			return inst, false
+		}
+		inst.Mnemonic = "NOT"
+		inst.Operands = []string{dr, sr1}
+	case 0xC: // JMP, RET
+		switch {
+		case word == 0xC1C0:
+			inst.Mnemonic = "RET"
+		case word&0xE3F == 0:
+			inst.Mnemonic = "JMP"
+			inst.Operands = []string{sr1}
+		default:
+			return inst, false
+		}
+	case 0xF: // TRAP
+		if word&0xF00 != 0 {
+			return inst, false
+		}
+		inst.Mnemonic = trapName(word & 0xFF)
+		if inst.Mnemonic == "TRAP" {
+			inst.Operands = []string{fmt.Sprintf("#%d", word&0xFF)}
+		}
+	default:
+		return inst, false
+	}
+
+	return inst, true
+}
+
+// Format renders the instruction, writing its target as a label when
+// labels names it and as an offset such as #-3 otherwise. labels may be
+// nil.
+func (inst Instruction) Format(labels Labels) string {
+	operands := inst.Operands
+	if inst.HasTarget {
+		target := fmt.Sprintf("#%d", int16(inst.Target-inst.Address-1))
+		if labels != nil {
+			if name, ok := labels(inst.Target); ok {
+				target = name
+			}
+		}
+		operands = append(operands[:len(operands):len(operands)], target)
+	}
+
+	if len(operands) == 0 {
+		return inst.Mnemonic
+	}
+	return inst.Mnemonic + " " + strings.Join(operands, ", ")
+}
+
+// Disassemble renders the word stored at address as an instruction, or as
+// .FILL when it does not decode.
+func Disassemble(address, word uint16, labels Labels) string {
+	if inst, ok := Decode(address, word); ok {
+		return inst.Format(labels)
+	}
+	return fmt.Sprintf(".FILL #%d", int16(word))
+}
+
+func (inst *Instruction) target(word uint16, bits int) {
+	inst.Target = inst.Address + 1 + signExtend(word, bits)
+	inst.HasTarget = true
+}
+
+func register(bits uint16) string {
+	return fmt.Sprintf("R%d", bits&7)
+}
+
+// trapName returns the alias for a trap vector, or TRAP.
+func trapName(vector uint16) string {
+	for name, v := range token.TrapVectors {
+		if uint16(v) == vector {
+			return name
+		}
+	}
+	return "TRAP"
+}
+
+// signExtend sign extends the low n bits of value to 16 bits.
+func signExtend(value uint16, n int) uint16 {
+	value &= 1<<n - 1
+	if value&(1<<(n-1)) != 0 {
+		value |= 0xFFFF << n
+	}
+	return value
+}
@@ -0,0 +1,182 @@
+package disasm
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/lc3os"
+)
+
+func TestDecode(t *testing.T) {
+	labels := func(address uint16) (string, bool) {
+		return "TARGET", address == 0x3001
+	}
+
+	tests := []struct {
+		word     uint16
+		expected string
+	}{
+		{0x103F, "ADD R0, R0, #-1"},
+		{0x1283, "ADD R1, R2, R3"},
+		{0x5020, "AND R0, R0, #0"},
+		{0x92BF, "NOT R1, R2"},
+		{0x03FE, "BRp #-2"},
+		{0x0FFE, "BRnzp #-2"},
+		{0x0BFF, "BRnp TARGET"},
+		{0x2004, "LD R0, #4"},
+		{0xA3FF, "LDI R1, TARGET"},
+		{0xE5FF, "LEA R2, TARGET"},
+		{0x3600, "ST R3, #0"},
+		{0xB9FF, "STI R4, TARGET"},
+		{0x697E, "LDR R4, R5, #-2"},
+		{0x7943, "STR R4, R5, #3"},
+		{0x4FFF, "JSR TARGET"},
+		{0x4080, "JSRR R2"},
+		{0xC0C0, "JMP R3"},
+		{0xC1C0, "RET"},
+		{0x8000, "RTI"},
+		{0xF025, "HALT"},
+		{0xF020, "GETC"},
+		{0xF030, "TRAP #48"},
+	}
+
+	for i, tt := range tests {
+		if text := Disassemble(0x3001, tt.word, labels); text != tt.expected {
+			t.Errorf("tests[%d] - x%04X wrong. expected=%q, got=%q", i, tt.word, tt.expected, text)
+		}
+	}
+
+	// Words the assembler never produces are data
+	data := []uint16{0x0000, 0x0123, 0x1008, 0x9000, 0x8001, 0xC1C1, 0x4001, 0xF125, 0xD000}
+	for i, word := range data {
+		if _, ok := Decode(0x3000, word); ok {
+			t.Errorf("data[%d] - x%04X decoded as an instruction", i, word)
+		}
+	}
+}
+
+func TestReassemble(t *testing.T) {
+	// Every instruction word must assemble back to itself
+	for word := 0; word < 0x10000; word++ {
+		inst, ok := Decode(0x3000, uint16(word))
+		if !ok {
+			continue
+		}
+
+		src := ".ORIG x3000\n" + inst.Format(nil) + "\n.END"
+		obj, err := assembler.Assemble(src)
+		if err != nil {
+			t.Fatalf("x%04X: %q does not assemble: %s", word, inst.Format(nil), err)
+		}
+		if obj.Code[0] != uint16(word) {
+			t.Fatalf("x%04X: %q assembles to x%04X", word, inst.Format(nil), obj.Code[0])
+		}
+	}
+}
+
+const program = `	.ORIG x3000
+START	LEA R0, MSG
+	PUTS
+	LD R1, COUNT
+LOOP	JSR SUB
+	ADD R1, R1, #-1
+	BRp LOOP
+	HALT
+SUB	ADD R2, R2, #1
+	RET
+COUNT	.FILL #3
+MSG	.STRINGZ "Hi"
+	.END`
+
+func TestWriteSource(t *testing.T) {
+	obj, err := assembler.Assemble(program)
+	if err != nil {
+		t.Fatalf("assembly failed:\n%s", err)
+	}
+
+	// Without symbols, labels are generated for targets only
+	symbols := obj.Symbols
+	obj.Symbols = nil
+	expected := `      .ORIG #12288
+      LEA R0, L300A            ; x3000 xE009
+      PUTS                     ; x3001 xF022
+      LD R1, L3009             ; x3002 x2206
+L3003 JSR L3007                ; x3003 x4803
+      ADD R1, R1, #-1          ; x3004 x127F
+      BRp L3003                ; x3005 x03FD
+      HALT                     ; x3006 xF025
+L3007 ADD R2, R2, #1           ; x3007 x14A1
+      RET                      ; x3008 xC1C0
+L3009 .FILL #3                 ; x3009 x0003
+L300A .FILL #72                ; x300A x0048 'H'
+      .FILL #105               ; x300B x0069 'i'
+      .FILL #0                 ; x300C x0000
+      .END
+`
+	if src := writeSource(t, obj); src != expected {
+		t.Errorf("source wrong. expected=\n%s\ngot=\n%s", expected, src)
+	}
+
+	obj.Symbols = symbols
+	src := writeSource(t, obj)
+	for _, line := range []string{
+		"START LEA R0, MSG              ; x3000 xE009",
+		"LOOP  JSR SUB                  ; x3003 x4803",
+		"      BRp LOOP                 ; x3005 x03FD",
+		"COUNT .FILL #3                 ; x3009 x0003",
+	} {
+		if !strings.Contains(src, line+"\n") {
+			t.Errorf("source missing %q:\n%s", line, src)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	objects := []*assembler.Object{lc3os.Image()}
+
+	obj, err := assembler.Assemble(program)
+	if err != nil {
+		t.Fatalf("assembly failed:\n%s", err)
+	}
+	objects = append(objects, obj)
+
+	// Arbitrary words, including ones that branch out of the image
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		code := make([]uint16, 1+random.Intn(200))
+		for j := range code {
+			code[j] = uint16(random.Intn(0x10000))
+		}
+		objects = append(objects, &assembler.Object{Origin: uint16(random.Intn(0xFF00)), Code: code})
+	}
+
+	for i, obj := range objects {
+		src := writeSource(t, obj)
+		again, err := assembler.Assemble(src)
+		if err != nil {
+			t.Fatalf("objects[%d] - disassembly does not assemble:\n%s\n%s", i, err, src)
+		}
+		if again.Origin != obj.Origin || len(again.Code) != len(obj.Code) {
+			t.Fatalf("objects[%d] - image wrong. expected=x%04X+%d, got=x%04X+%d",
+				i, obj.Origin, len(obj.Code), again.Origin, len(again.Code))
+		}
+		for j := range obj.Code {
+			if again.Code[j] != obj.Code[j] {
+				t.Fatalf("objects[%d] - word %d wrong. expected=x%04X, got=x%04X", i, j, obj.Code[j], again.Code[j])
+			}
+		}
+	}
+}
+
+func writeSource(t *testing.T, obj *assembler.Object) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteSource(&buf, obj); err != nil {
+		t.Fatalf("WriteSource failed: %s", err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,131 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"lc3asm-parser/assembler"
+)
+
+// WriteSource writes assembly for obj that assembles back to the same
+// image. Words reached by following control flow from the origin are
+// written as instructions and everything else as .FILL. Addresses are
+// named after obj.Symbols where it has a name, and branch, load and
+// subroutine targets inside the image are given generated labels such as
+// L3004. Every line is annotated with its address and word.
+func WriteSource(w io.Writer, obj *assembler.Object) error {
+	code := reachable(obj)
+	labels := makeLabels(obj, code)
+
+	width := 0
+	for _, name := range labels {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	lookup := func(address uint16) (string, bool) {
+		name, ok := labels[address]
+		return name, ok
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-*s .ORIG #%d\n", width, "", obj.Origin)
+
+	for i, word := range obj.Code {
+		address := obj.Origin + uint16(i)
+
+		var text, note string
+		if code[i] {
+			text = Disassemble(address, word, lookup)
+		} else {
+			text = fmt.Sprintf(".FILL %s", number(word))
+			if word >= ' ' && word < 0x7F {
+				note = fmt.Sprintf(" %q", rune(word))
+			}
+		}
+
+		fmt.Fprintf(bw, "%-*s %-24s ; x%04X x%04X%s\n", width, labels[address], text, address, word, note)
+	}
+
+	fmt.Fprintf(bw, "%-*s .END\n", width, "")
+	return bw.Flush()
+}
+
+// reachable marks the words of obj reached by following control flow from
+// its origin. Flow stops at words that do not decode, at unconditional
+// jumps and returns and at HALT.
+func reachable(obj *assembler.Object) []bool {
+	code := make([]bool, len(obj.Code))
+	inside := func(address uint16) bool {
+		return address >= obj.Origin && int(address-obj.Origin) < len(obj.Code)
+	}
+
+	work := []uint16{obj.Origin}
+	for len(work) > 0 {
+		address := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		for inside(address) && !code[address-obj.Origin] {
+			inst, ok := Decode(address, obj.Code[address-obj.Origin])
+			if !ok {
+				break
+			}
+			code[address-obj.Origin] = true
+
+			if inst.HasTarget && (inst.Mnemonic == "JSR" || strings.HasPrefix(inst.Mnemonic, "BR")) {
+				work = append(work, inst.Target)
+			}
+			if inst.Mnemonic == "BRnzp" || inst.Mnemonic == "JMP" || inst.Mnemonic == "RET" ||
+				inst.Mnemonic == "RTI" || inst.Mnemonic == "HALT" {
+				break
+			}
+			address++
+		}
+	}
+	return code
+}
+
+// makeLabels names the addresses in obj that need a label: its symbols and
+// the targets of the instructions marked in code.
+func makeLabels(obj *assembler.Object, code []bool) map[uint16]string {
+	labels := make(map[uint16]string)
+	taken := make(map[string]bool)
+	inside := func(address uint16) bool {
+		return address >= obj.Origin && int(address-obj.Origin) < len(obj.Code)
+	}
+
+	if obj.Symbols != nil {
+		for _, sym := range obj.Symbols.Symbols() {
+			if _, ok := labels[sym.Address]; !ok && inside(sym.Address) {
+				labels[sym.Address] = sym.Name
+				taken[sym.Name] = true
+			}
+		}
+	}
+
+	for i, word := range obj.Code {
+		if !code[i] {
+			continue
+		}
+		inst, _ := Decode(obj.Origin+uint16(i), word)
+		if _, ok := labels[inst.Target]; !inst.HasTarget || ok || !inside(inst.Target) {
+			continue
+		}
+
+		name := fmt.Sprintf("L%04X", inst.Target)
+		for taken[name] {
+			name += "_"
+		}
+		labels[inst.Target] = name
+		taken[name] = true
+	}
+	return labels
+}
+
+// number formats value as an assembler literal.
+func number(value uint16) string {
+	return fmt.Sprintf("#%d", int16(value))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"lc3asm-parser/format"
+	"lc3asm-parser/parser"
+)
+
+// formatFiles implements `fmt [-w] [-l] file.asm...`. Without -w or -l
+// the formatted source is written to standard output.
+func formatFiles(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the result back to the source file")
+	list := fs.Bool("l", false, "list files whose formatting differs")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("usage: fmt [-w] [-l] file.asm...")
+	}
+
+	for _, path := range fs.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		out, err := format.Source(string(src))
+		if list, ok := err.(parser.ErrorList); ok {
+			msgs := make([]string, len(list))
+			for i, e := range list {
+				msgs[i] = fmt.Sprintf("%s:%s", path, e)
+			}
+			return errors.New(strings.Join(msgs, "\n"))
+		} else if err != nil {
+			return err
+		}
+
+		if *list && out != string(src) {
+			fmt.Println(path)
+		}
+		if *write && out != string(src) {
+			if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+				return err
+			}
+		}
+		if !*write && !*list {
+			fmt.Print(out)
+		}
+	}
+	return nil
+}
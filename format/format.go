@@ -0,0 +1,260 @@
+// Package format prints assembly programs in a canonical layout: labels
+// in column 0, opcodes and directives at a common indent, operands and
+// trailing comments aligned, opcodes and registers in upper case and
+// numbers spelled one way.
+package format
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"lc3asm-parser/ast"
+	"lc3asm-parser/lexer"
+	"lc3asm-parser/parser"
+	"lc3asm-parser/token"
+)
+
+// MinIndent is the column opcodes start at when no label is longer.
+// Longer labels push the opcodes of the whole file further right.
+const MinIndent = 8
+
+// Source parses src and returns it formatted. Parser errors are returned
+// as a parser.ErrorList.
+func Source(src string) (string, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return "", parser.ErrorList(errs)
+	}
+
+	var sb strings.Builder
+	if err := Fprint(&sb, program); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// line is one output line: a statement with its label, a label on its
+// own, or a comment on its own.
+type line struct {
+	blank   bool // Whether a blank line comes first
+	label   string
+	opcode  string
+	operand string
+	comment string
+	indent  bool // Whether a full-line comment is indented
+}
+
+func (l *line) code() bool { return l.label != "" || l.opcode != "" }
+
+// Fprint writes program to w with the comments and blank lines recorded
+// in program.Trivia and program.EndComments. Runs of blank lines in the
+// source become a single blank line.
+func Fprint(w io.Writer, program *ast.Program) error {
+	lines := collect(program)
+
+	indent, opcodeWidth := MinIndent, 0
+	for _, l := range lines {
+		if len(l.label)+1 > indent {
+			indent = len(l.label) + 1
+		}
+		if len(l.opcode) > opcodeWidth {
+			opcodeWidth = len(l.opcode)
+		}
+	}
+
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		switch {
+		case l.code():
+			text := l.label
+			if l.opcode != "" {
+				text = fmt.Sprintf("%-*s%-*s %s", indent, l.label, opcodeWidth, l.opcode, l.operand)
+			}
+			texts[i] = strings.TrimRight(text, " ")
+		case l.indent:
+			texts[i] = strings.Repeat(" ", indent) + l.comment
+		default:
+			texts[i] = l.comment
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for start := 0; start < len(lines); {
+		// Trailing comments are aligned within a block of code lines
+		// ended by a blank line or a full-line comment.
+		end := start
+		column := 0
+		for end < len(lines) && lines[end].code() && (end == start || !lines[end].blank) {
+			if lines[end].comment != "" && len(texts[end])+1 > column {
+				column = len(texts[end]) + 1
+			}
+			end++
+		}
+		if end == start {
+			end++
+		}
+
+		for i := start; i < end; i++ {
+			if i > 0 && lines[i].blank {
+				bw.WriteString("\n")
+			}
+			text := texts[i]
+			if lines[i].code() && lines[i].comment != "" {
+				text = fmt.Sprintf("%-*s%s", column, text, lines[i].comment)
+			}
+			bw.WriteString(text + "\n")
+		}
+		start = end
+	}
+	return bw.Flush()
+}
+
+// collect turns the statements and comments of program into lines,
+// joining each label to an instruction on the same source line.
+func collect(program *ast.Program) []line {
+	var lines []line
+	for i, stmt := range program.Statements {
+		trivia := program.TriviaOf(stmt)
+		label, isLabel := stmt.(*ast.Label)
+
+		n := len(lines)
+		if n > 0 && !isLabel && lines[n-1].opcode == "" && lines[n-1].comment == "" &&
+			program.Statements[i-1].Pos().Line == stmt.Pos().Line {
+			lines[n-1].opcode, lines[n-1].operand = instruction(stmt)
+			lines[n-1].comment = text(trivia.Trailing)
+			continue
+		}
+
+		for _, c := range trivia.Leading {
+			lines = append(lines, commentLine(c))
+		}
+
+		l := line{blank: trivia.BlankBefore, comment: text(trivia.Trailing)}
+		if isLabel {
+			l.label = label.Value
+		} else {
+			l.opcode, l.operand = instruction(stmt)
+		}
+		lines = append(lines, l)
+	}
+
+	for _, c := range program.EndComments {
+		lines = append(lines, commentLine(c))
+	}
+	return lines
+}
+
+func commentLine(c *ast.Comment) line {
+	return line{blank: c.BlankBefore, comment: text(c), indent: c.Pos().Column > 1}
+}
+
+// text returns the text of c without trailing space, or "" for no comment.
+func text(c *ast.Comment) string {
+	if c == nil {
+		return ""
+	}
+	return strings.TrimRight(c.Text, " \t\r")
+}
+
+// instruction returns the canonical opcode and operands of stmt.
+func instruction(stmt ast.Statement) (string, string) {
+	switch stmt := stmt.(type) {
+	case *ast.ThreeRegisterStatement:
+		return opcode(stmt.Opcode), operands(register(stmt.DataRegister),
+			register(stmt.SourceRegisters[0]), register(stmt.SourceRegisters[1]))
+	case *ast.TwoRegisterImmediate:
+		return opcode(stmt.Opcode), operands(register(stmt.DataRegister),
+			register(stmt.SourceRegister), number(stmt.Immediate))
+	case *ast.RegisterLabelStatement:
+		return opcode(stmt.Opcode), operands(register(stmt.Register), target(stmt.Label, stmt.Offset))
+	case *ast.TwoRegisterOffset:
+		return opcode(stmt.Opcode), operands(register(stmt.LeftRegister),
+			register(stmt.RightRegister), number(stmt.Offset))
+	case *ast.TwoRegister:
+		return opcode(stmt.Opcode), operands(register(stmt.DataRegister), register(stmt.SourceRegister))
+	case *ast.OneRegister:
+		return opcode(stmt.Opcode), register(stmt.Register)
+	case *ast.BranchStatement:
+		name := "BR"
+		if stmt.N {
+			name += "n"
+		}
+		if stmt.Z {
+			name += "z"
+		}
+		if stmt.P {
+			name += "p"
+		}
+		return name, target(stmt.Label, stmt.Offset)
+	case *ast.SubroutineStatement:
+		return opcode(stmt.Opcode), target(stmt.Label, stmt.Offset)
+	case *ast.NoOperand:
+		return opcode(stmt.Opcode), ""
+	case *ast.TrapStatement:
+		if name := opcode(stmt.Opcode); name != "TRAP" {
+			return name, ""
+		}
+		return "TRAP", number(stmt.Vector)
+	case *ast.OrigDirective:
+		return ".ORIG", number(stmt.Address)
+	case *ast.FillDirective:
+		return ".FILL", target(stmt.Label, stmt.Value)
+	case *ast.BlkwDirective:
+		return ".BLKW", number(stmt.Count)
+	case *ast.StringzDirective:
+		return ".STRINGZ", stmt.Value.Token.Literal
+	case *ast.EndDirective:
+		return ".END", ""
+	case *ast.BeginDirective:
+		return ".BEGIN", ""
+	}
+	return stmt.TokenLiteral(), ""
+}
+
+func opcode(o *ast.Opcode) string {
+	return o.Literal
+}
+
+func register(r *ast.Register) string {
+	return fmt.Sprintf("R%d", r.ID)
+}
+
+func target(label *ast.Label, offset *ast.IntegerLiteral) string {
+	if label != nil {
+		return label.Value
+	}
+	return number(offset)
+}
+
+// number keeps the radix a literal was written in but spells it one way:
+// #10, x1F with upper-case digits, b101, 'A'. Hexadecimal keeps its
+// leading zeros, so x00FF stays four digits wide.
+func number(il *ast.IntegerLiteral) string {
+	switch il.Token.Type {
+	case token.CHAR:
+		return il.Token.Literal
+	case token.HEX:
+		width := len(digits(il.Token.Literal))
+		if il.Value < 0 {
+			return fmt.Sprintf("x-%0*X", width, -il.Value)
+		}
+		return fmt.Sprintf("x%0*X", width, il.Value)
+	case token.BIN:
+		return "b" + digits(il.Token.Literal)
+	}
+	return fmt.Sprintf("#%d", il.Value)
+}
+
+// digits strips the prefix and sign from a hexadecimal or binary literal:
+// x-1F, 0x1F and b101 give 1F, 1F and 101.
+func digits(literal string) string {
+	literal = strings.TrimPrefix(literal, "0")
+	return strings.TrimPrefix(literal[1:], "-")
+}
+
+func operands(ops ...string) string {
+	return strings.Join(ops, ", ")
+}
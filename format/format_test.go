@@ -0,0 +1,94 @@
+package format
+
+import (
+	"testing"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/lc3os"
+)
+
+func TestSource(t *testing.T) {
+	input := `; Count down from ten
+
+
+	.ORIG x3000
+	  ; set up
+START:	and r0,R0,#0
+	ADD R0,R0,10 ; ten
+LOOP
+	  brPZ LOOP   ; again
+	BR DONE
+	TRAP x21
+DONE HALT ; stop
+MESSAGE .STRINGZ "a; b\n"
+MASK .FILL 0xff0f
+	.FILL B0101
+	.FILL x-1
+	.FILL #'\n'
+	.END
+; after`
+
+	expected := `; Count down from ten
+
+        .ORIG    x3000
+        ; set up
+START   AND      R0, R0, #0
+        ADD      R0, R0, #10 ; ten
+LOOP
+        BRzp     LOOP        ; again
+        BR       DONE
+        TRAP     x21
+DONE    HALT                 ; stop
+MESSAGE .STRINGZ "a; b\n"
+MASK    .FILL    xFF0F
+        .FILL    b0101
+        .FILL    x-1
+        .FILL    '\n'
+        .END
+; after
+`
+
+	out, err := Source(input)
+	if err != nil {
+		t.Fatalf("Source failed: %v", err)
+	}
+	if out != expected {
+		t.Errorf("output wrong.\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	again, err := Source(out)
+	if err != nil {
+		t.Fatalf("Source of formatted output failed: %v", err)
+	}
+	if again != out {
+		t.Errorf("formatting not idempotent.\nfirst:\n%s\nsecond:\n%s", out, again)
+	}
+}
+
+func TestReassemble(t *testing.T) {
+	out, err := Source(lc3os.Source)
+	if err != nil {
+		t.Fatalf("Source failed: %v", err)
+	}
+
+	obj, err := assembler.Assemble(out)
+	if err != nil {
+		t.Fatalf("formatted source does not assemble: %v", err)
+	}
+
+	image := lc3os.Image()
+	if obj.Origin != image.Origin || len(obj.Code) != len(image.Code) {
+		t.Fatalf("image wrong. expected=x%04X+%d, got=x%04X+%d", image.Origin, len(image.Code), obj.Origin, len(obj.Code))
+	}
+	for i, word := range image.Code {
+		if obj.Code[i] != word {
+			t.Errorf("code[%d] wrong. expected=x%04X, got=x%04X", i, word, obj.Code[i])
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Source("ADD R1,R2"); err == nil {
+		t.Errorf("expected error")
+	}
+}
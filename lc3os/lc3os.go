@@ -0,0 +1,39 @@
+// Package lc3os provides the operating system image loaded into every
+// machine: the trap and interrupt vector tables and the service routines
+// behind GETC, OUT, PUTS, IN, PUTSP and HALT. The image is assembled from
+// lc3os.asm by this repository's own assembler.
+package lc3os
+
+import (
+	_ "embed"
+	"sync"
+
+	"lc3asm-parser/assembler"
+)
+
+const (
+	TrapTable       = 0x0000 // Trap vector table, x0000-x00FF
+	InterruptTable  = 0x0100 // Interrupt vector table, x0100-x01FF
+	SupervisorStack = 0x3000 // The supervisor stack grows down from here
+)
+
+//go:embed lc3os.asm
+var Source string
+
+var (
+	once  sync.Once
+	image *assembler.Object
+)
+
+// Image returns the assembled operating system. The source is assembled
+// on first use; it is covered by tests, so failure is a programming error.
+func Image() *assembler.Object {
+	once.Do(func() {
+		obj, err := assembler.Assemble(Source)
+		if err != nil {
+			panic("lc3os: " + err.Error())
+		}
+		image = obj
+	})
+	return image
+}
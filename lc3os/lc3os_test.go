@@ -0,0 +1,52 @@
+package lc3os
+
+import (
+	"testing"
+
+	"lc3asm-parser/assembler"
+)
+
+func TestAssemble(t *testing.T) {
+	if _, err := assembler.Assemble(Source); err != nil {
+		t.Fatalf("operating system does not assemble:\n%s", err)
+	}
+}
+
+func TestVectorTables(t *testing.T) {
+	obj := Image()
+	if obj.Origin != TrapTable {
+		t.Fatalf("origin wrong. expected=x%04X, got=x%04X", TrapTable, obj.Origin)
+	}
+
+	tests := []struct {
+		vector uint16
+		label  string
+	}{
+		{TrapTable + 0x00, "BAD_TRAP"},
+		{TrapTable + 0x20, "TRAP_GETC"},
+		{TrapTable + 0x21, "TRAP_OUT"},
+		{TrapTable + 0x22, "TRAP_PUTS"},
+		{TrapTable + 0x23, "TRAP_IN"},
+		{TrapTable + 0x24, "TRAP_PUTSP"},
+		{TrapTable + 0x25, "TRAP_HALT"},
+		{TrapTable + 0xFF, "BAD_TRAP"},
+		{InterruptTable + 0x00, "PRIV_VIOLATION"},
+		{InterruptTable + 0x01, "ILLEGAL_OPCODE"},
+		{InterruptTable + 0x80, "BAD_INT"},
+	}
+
+	for i, tt := range tests {
+		sym, ok := obj.Symbols.Resolve(tt.label)
+		if !ok {
+			t.Fatalf("tests[%d] - label %s not defined", i, tt.label)
+		}
+		if got := obj.Code[tt.vector-obj.Origin]; got != sym.Address {
+			t.Errorf("tests[%d] - vector x%04X wrong. expected=%s (x%04X), got=x%04X",
+				i, tt.vector, tt.label, sym.Address, got)
+		}
+	}
+
+	if end := int(obj.Origin) + len(obj.Code); end > SupervisorStack-0x100 {
+		t.Errorf("image runs into the supervisor stack: ends at x%04X", end)
+	}
+}
@@ -1,6 +1,11 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
 	"lc3asm-parser/token"
 )
 
@@ -10,6 +15,9 @@ type Lexer struct {
 	readPosition int
 	ch           byte
 	indentation  int
+	line         int // line of ch
+	column       int // column of ch
+	strict       bool
 }
 
 func (l *Lexer) NextToken() token.Token {
@@ -23,6 +31,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.skipWhitespace()
+	start := l.pos()
 
 	switch l.ch {
 	case ',':
@@ -36,55 +45,83 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok.Type = token.COMMENT
 		}
-		return tok
+		return l.locate(tok, start)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case '#':
 		tok = newToken(token.HASH, l.ch)
+	case '"':
+		return l.locate(l.readString(), start)
+	case '\'':
+		return l.locate(l.readCharacter(), start)
 	case '-':
-		tok.Literal = string(l.ch)
 		if isDigit(l.peekChar()) {
-			l.readChar()
-			tok.Literal = tok.Literal + l.readNumber()
-			tok.Type = token.INT
-			return tok
+			return l.locate(l.readNumber(), start)
 		}
+		tok = newToken(token.ILLEGAL, l.ch)
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
-		if isLetter(l.ch) {
+		if (l.ch == 'x' || l.ch == 'X') && l.peekChar() == '-' && isDigitOf(16, l.peekChars(1)) {
+			// x-1
+			position := l.position
+			l.readChar()
+			l.readChar()
+			return l.locate(l.readDigits(position, 16), start)
+		} else if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
-			if isHex(tok.Literal) {
-				tok.Type = token.HEX
-				return tok
+			if base := prefixBase(tok.Literal[0]); base != 0 && isNumber(base, tok.Literal[1:]) {
+				return l.locate(number(tok.Literal, tok.Literal[1:], base), start)
 			}
-			tok.Type = token.LookupIdent(tok.Literal)
-			return tok
+			if l.strict {
+				tok.Type = token.LookupIdentStrict(tok.Literal)
+			} else {
+				tok.Type = token.LookupIdent(tok.Literal)
+			}
+			return l.locate(tok, start)
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
-			return tok
+			return l.locate(l.readNumber(), start)
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 
+	if tok.Type == token.EOF {
+		return l.locate(tok, start)
+	}
+
 	l.readChar()
-	return tok
+	return l.locate(tok, start)
 }
 
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// New returns a lexer that recognizes keywords in any case.
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// NewStrict returns a lexer that only recognizes keywords in their
+// canonical case, such as ADD, R1, ORIG and BRnz; add or r1 are
+// identifiers.
+func NewStrict(input string) *Lexer {
+	l := New(input)
+	l.strict = true
+	return l
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -94,6 +131,18 @@ func (l *Lexer) readChar() {
 	l.readPosition++
 }
 
+// pos returns the position of the current character.
+func (l *Lexer) pos() token.Position {
+	return token.Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
+// locate stamps tok with the span from start up to the current character.
+func (l *Lexer) locate(tok token.Token, start token.Position) token.Token {
+	tok.Pos = start
+	tok.End = l.pos()
+	return tok
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) || isDigit(l.ch) {
@@ -107,7 +156,7 @@ func isLetter(ch byte) bool {
 }
 
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\n' || l.ch == '\r' {
+	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
 	}
 }
@@ -115,6 +164,7 @@ func (l *Lexer) skipWhitespace() {
 // Read indentation characters
 func (l *Lexer) readIndentation() token.Token {
 	l.readChar()
+	start := l.pos()
 	indents := 0
 
 	// Consumes tab or spaces for counting indentation levels
@@ -130,7 +180,7 @@ func (l *Lexer) readIndentation() token.Token {
 		l.indentation = l.indentation - indents
 		tok.Type = token.DEDENT
 		tok.Literal = "DEDENT"
-		return tok
+		return l.locate(tok, start)
 	}
 
 	// Checks if indentation has incresed
@@ -138,25 +188,110 @@ func (l *Lexer) readIndentation() token.Token {
 		l.indentation = l.indentation + indents
 		tok.Type = token.INDENT
 		tok.Literal = "INDENT"
-		return tok
+		return l.locate(tok, start)
 	}
 
 	// If no change in indentation, return empty token
 	return tok
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads a number starting with a digit or a minus sign: 12,
+// -12, 0x1F or 0b101.
+func (l *Lexer) readNumber() token.Token {
 	position := l.position
-	for isDigit(l.ch) {
+	if l.ch == '-' {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	base := 10
+	if l.ch == '0' {
+		if b := prefixBase(l.peekChar()); b != 0 {
+			base = b
+			l.readChar()
+			l.readChar()
+		}
+	}
+	return l.readDigits(position, base)
+}
+
+// readDigits reads the digits of a number in base whose literal started
+// at position. Letters and digits running on from them are part of the
+// literal, making it malformed.
+func (l *Lexer) readDigits(position, base int) token.Token {
+	digits := l.position
+	for isLetter(l.ch) || isDigit(l.ch) {
+		l.readChar()
+	}
+	return number(l.input[position:l.position], l.input[digits:l.position], base)
+}
+
+var baseNames = map[int]string{2: "binary", 10: "decimal", 16: "hexadecimal"}
+
+// number returns the token for literal, whose digits are in base, or an
+// ILLEGAL token saying what is wrong with it.
+func number(literal, digits string, base int) token.Token {
+	tok := token.Token{Type: token.ILLEGAL, Literal: literal}
+
+	if digits == "" {
+		tok.Reason = baseNames[base] + " number has no digits"
+		return tok
+	}
+	for i := 0; i < len(digits); i++ {
+		if !isDigitOf(base, digits[i]) {
+			tok.Reason = fmt.Sprintf("invalid digit %q in %s number", digits[i], baseNames[base])
+			return tok
+		}
+	}
+
+	value, err := strconv.ParseInt(digits, base, 32)
+	if err != nil {
+		tok.Reason = "number out of range"
+		return tok
+	}
+	if strings.Contains(literal, "-") {
+		value = -value
+	}
+
+	tok.Type, tok.Value = map[int]token.TokenType{2: token.BIN, 10: token.INT, 16: token.HEX}[base], int(value)
+	return tok
+}
+
+// prefixBase returns the base selected by a number prefix: x for
+// hexadecimal and b for binary, in either case, or 0.
+func prefixBase(ch byte) int {
+	switch ch {
+	case 'x', 'X':
+		return 16
+	case 'b', 'B':
+		return 2
+	}
+	return 0
 }
 
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isDigitOf(base int, ch byte) bool {
+	switch base {
+	case 2:
+		return ch == '0' || ch == '1'
+	case 16:
+		return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+	}
+	return isDigit(ch)
+}
+
+// isNumber reports whether s is a run of digits in base.
+func isNumber(base int, s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigitOf(base, s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
 		return 0
@@ -184,44 +319,110 @@ func (l *Lexer) readRegister() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readHex() string {
+func (l *Lexer) parseBranch() token.Token {
+	l.readChar()
+	return token.Token{}
+}
+
+func isWhitespace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+}
+
+func (l *Lexer) readComment() string {
 	position := l.position
 	l.readChar()
-	for isDigit(l.ch) {
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
 
 	return l.input[position:l.position]
 }
 
-func isHex(literal string) bool {
-	return literal[0] == 'x' && isNumber(literal[1:])
-}
+// readString reads a double quoted string. Str is its text with escapes
+// decoded. A string left open at the end of the line, or with an escape
+// that does not decode, is ILLEGAL.
+func (l *Lexer) readString() token.Token {
+	literal, ok := l.readQuoted('"')
+	if !ok {
+		return token.Token{Type: token.ILLEGAL, Literal: literal, Reason: "string not terminated"}
+	}
 
-func isNumber(substr string) bool {
-	for _, ch := range substr {
-		if !isDigit(byte(ch)) {
-			return false
-		}
+	str, err := unescape(literal[1 : len(literal)-1])
+	if err != nil {
+		return token.Token{Type: token.ILLEGAL, Literal: literal, Reason: err.Error()}
 	}
-	return true
+	return token.Token{Type: token.STRING, Literal: literal, Str: str}
 }
 
-func (l *Lexer) parseBranch() token.Token {
-	l.readChar()
-	return token.Token{}
-}
+// readCharacter reads a single quoted character such as 'A' or '\n'.
+// Value is the character code.
+func (l *Lexer) readCharacter() token.Token {
+	literal, ok := l.readQuoted('\'')
+	if !ok {
+		return token.Token{Type: token.ILLEGAL, Literal: literal, Reason: "character not terminated"}
+	}
 
-func isWhitespace(ch byte) bool {
-	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+	tok := token.Token{Type: token.ILLEGAL, Literal: literal}
+	str, err := unescape(literal[1 : len(literal)-1])
+	switch {
+	case err != nil:
+		tok.Reason = err.Error()
+	case str == "":
+		tok.Reason = "empty character"
+	case len(str) > 1:
+		tok.Reason = "more than one character between single quotes"
+	default:
+		tok.Type, tok.Value = token.CHAR, int(str[0])
+	}
+	return tok
 }
 
-func (l *Lexer) readComment() string {
+// readQuoted reads from quote to the matching closing quote, which a
+// backslash escapes, and returns the text with both quotes. If the line
+// ends first, ok is false and the text runs from the opening quote to the
+// end of the line.
+func (l *Lexer) readQuoted(quote byte) (literal string, ok bool) {
 	position := l.position
 	l.readChar()
-	for l.ch != '\n' && l.ch != 0 {
+	for l.ch != quote {
+		if l.ch == '\n' || l.ch == 0 {
+			return l.input[position:l.position], false
+		}
+		if l.ch == '\\' && l.peekChar() != '\n' && l.peekChar() != 0 {
+			l.readChar()
+		}
 		l.readChar()
 	}
+	l.readChar()
+	return l.input[position:l.position], true
+}
 
-	return l.input[position:l.position]
+var escapes = map[byte]byte{'n': '\n', 't': '\t', '"': '"', '\'': '\'', '\\': '\\', '0': 0}
+
+// unescape decodes the escapes in the text of a string or character: \n,
+// \t, \", \', \\, \0 and \xNN with two hexadecimal digits.
+func unescape(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if ch, ok := escapes[s[i]]; ok {
+			b.WriteByte(ch)
+			continue
+		}
+		if s[i] == 'x' && i+2 < len(s) && isDigitOf(16, s[i+1]) && isDigitOf(16, s[i+2]) {
+			value, _ := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			b.WriteByte(byte(value))
+			i += 2
+			continue
+		}
+		if s[i] == 'x' {
+			return "", errors.New(`escape \x needs two hexadecimal digits`)
+		}
+		return "", fmt.Errorf("unknown escape sequence \\%c", s[i])
+	}
+	return b.String(), nil
 }
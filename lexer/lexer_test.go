@@ -443,6 +443,43 @@ HALT`
 
 }
 
+func TestKeywordCase(t *testing.T) {
+	input := `add r1,R2
+BrNz
+.orig
+Halt
+loop`
+
+	tests := []struct {
+		literal string
+		normal  token.TokenType
+		strict  token.TokenType
+	}{
+		{"add", token.OPCODE, token.IDENT},
+		{"r1", token.REGISTER, token.IDENT},
+		{",", token.COMMA, token.COMMA},
+		{"R2", token.REGISTER, token.REGISTER},
+		{"BrNz", token.OPCODE, token.IDENT},
+		{".", token.PERIOD, token.PERIOD},
+		{"orig", token.DIRECTIVE, token.IDENT},
+		{"Halt", token.TRAP, token.IDENT},
+		{"loop", token.IDENT, token.IDENT},
+	}
+
+	normal, strict := New(input), NewStrict(input)
+	for i, tt := range tests {
+		tok := normal.NextToken()
+		if tok.Type != tt.normal || tok.Literal != tt.literal {
+			t.Errorf("tests[%d] - token wrong. expected=%s %q, got=%s %q", i, tt.normal, tt.literal, tok.Type, tok.Literal)
+		}
+
+		tok = strict.NextToken()
+		if tok.Type != tt.strict || tok.Literal != tt.literal {
+			t.Errorf("tests[%d] - strict token wrong. expected=%s %q, got=%s %q", i, tt.strict, tt.literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
 func TestDirectives(t *testing.T) {
 	input := `.END
 .BEGIN
@@ -519,6 +556,186 @@ func TestInts(t *testing.T) {
 
 }
 
+func TestNumbers(t *testing.T) {
+	input := `xFE00 xfe02 X7fff x-1 0x1F 0XABC b1011 B0 0b101 12 -12 x3000`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedValue   int
+	}{
+		{token.HEX, "xFE00", 0xFE00},
+		{token.HEX, "xfe02", 0xFE02},
+		{token.HEX, "X7fff", 0x7FFF},
+		{token.HEX, "x-1", -1},
+		{token.HEX, "0x1F", 0x1F},
+		{token.HEX, "0XABC", 0xABC},
+		{token.BIN, "b1011", 11},
+		{token.BIN, "B0", 0},
+		{token.BIN, "0b101", 5},
+		{token.INT, "12", 12},
+		{token.INT, "-12", -12},
+		{token.HEX, "x3000", 0x3000},
+		{token.EOF, "", 0},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Value != tt.expectedValue {
+			t.Errorf("tests[%d] - value wrong. expected=%d, got=%d", i, tt.expectedValue, tok.Value)
+		}
+	}
+}
+
+func TestMalformedNumbers(t *testing.T) {
+	input := `12a 0x 0x1G 0b102 x-G 99999999999 xG1 b12`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedReason  string
+	}{
+		{token.ILLEGAL, "12a", "invalid digit 'a' in decimal number"},
+		{token.ILLEGAL, "0x", "hexadecimal number has no digits"},
+		{token.ILLEGAL, "0x1G", "invalid digit 'G' in hexadecimal number"},
+		{token.ILLEGAL, "0b102", "invalid digit '2' in binary number"},
+		// Not numbers at all
+		{token.IDENT, "x", ""},
+		{token.ILLEGAL, "-", ""},
+		{token.IDENT, "G", ""},
+		{token.ILLEGAL, "99999999999", "number out of range"},
+		{token.IDENT, "xG1", ""},
+		{token.IDENT, "b12", ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Reason != tt.expectedReason {
+			t.Errorf("tests[%d] - reason wrong. expected=%q, got=%q", i, tt.expectedReason, tok.Reason)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `"Hello\n" "tab\there" "\"q\" \\ \0\x41" "bad\q" "bad\x4" "open
+"open at end`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedStr     string
+		expectedReason  string
+		expectedPos     string
+	}{
+		{token.STRING, `"Hello\n"`, "Hello\n", "", "1:1"},
+		{token.STRING, `"tab\there"`, "tab\there", "", "1:11"},
+		{token.STRING, `"\"q\" \\ \0\x41"`, "\"q\" \\ \x00A", "", "1:23"},
+		{token.ILLEGAL, `"bad\q"`, "", `unknown escape sequence \q`, "1:41"},
+		{token.ILLEGAL, `"bad\x4"`, "", `escape \x needs two hexadecimal digits`, "1:49"},
+		{token.ILLEGAL, `"open`, "", "string not terminated", "1:58"},
+		{token.ILLEGAL, `"open at end`, "", "string not terminated", "2:1"},
+		{token.EOF, "", "", "", "2:13"},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Str != tt.expectedStr {
+			t.Errorf("tests[%d] - str wrong. expected=%q, got=%q", i, tt.expectedStr, tok.Str)
+		}
+
+		if tok.Reason != tt.expectedReason {
+			t.Errorf("tests[%d] - reason wrong. expected=%q, got=%q", i, tt.expectedReason, tok.Reason)
+		}
+
+		if tok.Pos.String() != tt.expectedPos {
+			t.Errorf("tests[%d] - position wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+
+		if text := input[tok.Pos.Offset:tok.End.Offset]; tok.Literal != text {
+			t.Errorf("tests[%d] - literal is not the source text. expected=%q, got=%q", i, text, tok.Literal)
+		}
+	}
+}
+
+func TestCharacters(t *testing.T) {
+	input := `#'A' 'x' '\n' '\'' '"' '\x7F' '' 'ab' '\q' 'open`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedValue   int
+		expectedReason  string
+	}{
+		{token.HASH, "#", 0, ""},
+		{token.CHAR, "'A'", 'A', ""},
+		{token.CHAR, "'x'", 'x', ""},
+		{token.CHAR, `'\n'`, '\n', ""},
+		{token.CHAR, `'\''`, '\'', ""},
+		{token.CHAR, `'"'`, '"', ""},
+		{token.CHAR, `'\x7F'`, 0x7F, ""},
+		{token.ILLEGAL, "''", 0, "empty character"},
+		{token.ILLEGAL, "'ab'", 0, "more than one character between single quotes"},
+		{token.ILLEGAL, `'\q'`, 0, `unknown escape sequence \q`},
+		{token.ILLEGAL, "'open", 0, "character not terminated"},
+		{token.EOF, "", 0, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Value != tt.expectedValue {
+			t.Errorf("tests[%d] - value wrong. expected=%d, got=%d", i, tt.expectedValue, tok.Value)
+		}
+
+		if tok.Reason != tt.expectedReason {
+			t.Errorf("tests[%d] - reason wrong. expected=%q, got=%q", i, tt.expectedReason, tok.Reason)
+		}
+	}
+}
+
 func TestHex(t *testing.T) {
 	input := `.END
 .BEGIN
@@ -602,3 +819,50 @@ ADD`
 	}
 
 }
+
+func TestPositions(t *testing.T) {
+	input := `LOOP: ADD R1,R1,#-1
+	BRp LOOP ; again
+HALT`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+		expectedEnd     token.Position
+	}{
+		{"LOOP", token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 4, Line: 1, Column: 5}},
+		{":", token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 5, Line: 1, Column: 6}},
+		{"ADD", token.Position{Offset: 6, Line: 1, Column: 7}, token.Position{Offset: 9, Line: 1, Column: 10}},
+		{"R1", token.Position{Offset: 10, Line: 1, Column: 11}, token.Position{Offset: 12, Line: 1, Column: 13}},
+		{",", token.Position{Offset: 12, Line: 1, Column: 13}, token.Position{Offset: 13, Line: 1, Column: 14}},
+		{"R1", token.Position{Offset: 13, Line: 1, Column: 14}, token.Position{Offset: 15, Line: 1, Column: 16}},
+		{",", token.Position{Offset: 15, Line: 1, Column: 16}, token.Position{Offset: 16, Line: 1, Column: 17}},
+		{"#", token.Position{Offset: 16, Line: 1, Column: 17}, token.Position{Offset: 17, Line: 1, Column: 18}},
+		{"-1", token.Position{Offset: 17, Line: 1, Column: 18}, token.Position{Offset: 19, Line: 1, Column: 20}},
+		{"INDENT", token.Position{Offset: 20, Line: 2, Column: 1}, token.Position{Offset: 21, Line: 2, Column: 2}},
+		{"BRp", token.Position{Offset: 21, Line: 2, Column: 2}, token.Position{Offset: 24, Line: 2, Column: 5}},
+		{"LOOP", token.Position{Offset: 25, Line: 2, Column: 6}, token.Position{Offset: 29, Line: 2, Column: 10}},
+		{"; again", token.Position{Offset: 30, Line: 2, Column: 11}, token.Position{Offset: 37, Line: 2, Column: 18}},
+		{"DEDENT", token.Position{Offset: 38, Line: 3, Column: 1}, token.Position{Offset: 38, Line: 3, Column: 1}},
+		{"HALT", token.Position{Offset: 38, Line: 3, Column: 1}, token.Position{Offset: 42, Line: 3, Column: 5}},
+		{"", token.Position{Offset: 42, Line: 3, Column: 5}, token.Position{Offset: 42, Line: 3, Column: 5}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+
+		if tok.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tok.End)
+		}
+	}
+}
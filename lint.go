@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"lc3asm-parser/lexer"
+	"lc3asm-parser/lint"
+	"lc3asm-parser/parser"
+)
+
+// lintFiles implements `lint file.asm...`, printing one finding per line
+// as path:line:column: severity: message (rule).
+func lintFiles(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("usage: lint file.asm...")
+	}
+
+	count := 0
+	for _, path := range fs.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		p := parser.New(lexer.New(string(src)))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) > 0 {
+			msgs := make([]string, len(errs))
+			for i, e := range errs {
+				msgs[i] = fmt.Sprintf("%s:%s", path, e)
+			}
+			return errors.New(strings.Join(msgs, "\n"))
+		}
+
+		for _, f := range lint.Check(program) {
+			fmt.Printf("%s:%s\n", path, f)
+			count++
+		}
+	}
+
+	if count == 1 {
+		return errors.New("1 problem found")
+	}
+	if count > 0 {
+		return fmt.Errorf("%d problems found", count)
+	}
+	return nil
+}
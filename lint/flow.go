@@ -0,0 +1,112 @@
+package lint
+
+import (
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/ast"
+	"lc3asm-parser/cfg"
+	"lc3asm-parser/dataflow"
+	"lc3asm-parser/token"
+)
+
+// checkDataflow assembles the program and follows register values
+// through its control-flow graph. Programs that do not assemble are
+// left to the assembler's own errors.
+func (c *checker) checkDataflow(program *ast.Program) {
+	a := assembler.New(program)
+	obj := a.Assemble()
+	if len(a.Errors()) > 0 {
+		return
+	}
+
+	g := cfg.Build(obj)
+	flow := dataflow.Analyze(g)
+	for _, sub := range g.Subroutines {
+		for _, b := range sub.Blocks {
+			for i, stmt := range b.Statements {
+				c.checkReads(flow, b, i, stmt)
+				c.checkWrites(flow, b, i, stmt)
+			}
+		}
+	}
+}
+
+// checkReads reports registers read before the program writes them and
+// branches on condition codes that are undefined: no instruction in the
+// routine set them, or a call may have left anything in them. Which
+// register a branch meant to test is not known, so condition codes set
+// by an ordinary instruction are taken as intended.
+func (c *checker) checkReads(flow *dataflow.Analysis, b *cfg.Block, i int, stmt ast.Statement) {
+	for _, r := range dataflow.Reads(stmt).Registers() {
+		var entry, other bool
+		var call ast.Statement
+		for _, d := range flow.ReachingDefs(b, i, r) {
+			switch {
+			case flow.IsEntry(d):
+				entry = true
+			case d.Index >= 0 && dataflow.IsCall(d.Statement()):
+				call = d.Statement()
+				other = true
+			default:
+				other = true
+			}
+		}
+
+		switch {
+		case r == dataflow.CC && entry:
+			c.report(UndefinedCC, Warning, stmt.Pos(), "%s tests condition codes no instruction has set", opcodeName(stmt))
+		case r == dataflow.CC && call != nil:
+			c.report(UndefinedCC, Warning, stmt.Pos(), "%s tests condition codes left by %s at %s",
+				opcodeName(stmt), opcodeName(call), call.Pos())
+		case r != dataflow.CC && entry && other:
+			c.report(UninitializedRead, Warning, operand(stmt, r, true), "%s may be read before it is written", dataflow.Name(r))
+		case r != dataflow.CC && entry:
+			c.report(UninitializedRead, Warning, operand(stmt, r, true), "%s is read before it is written", dataflow.Name(r))
+		}
+	}
+}
+
+// checkWrites reports instructions whose result is never read, neither
+// from the register written nor through the condition codes it sets.
+func (c *checker) checkWrites(flow *dataflow.Analysis, b *cfg.Block, i int, stmt ast.Statement) {
+	writes := dataflow.Writes(stmt)
+	if writes == 0 || flow.LiveAfter(b, i)&writes != 0 {
+		return
+	}
+	for _, r := range writes.Registers() {
+		if r != dataflow.CC {
+			c.report(DeadWrite, Warning, operand(stmt, r, false), "value written to %s is never read", dataflow.Name(r))
+		}
+	}
+}
+
+// operand returns the position of the operand of stmt naming register
+// r, or of stmt itself. Sources follow the destination, so for a read
+// the last operand naming r is taken.
+func operand(stmt ast.Statement, r int, read bool) token.Position {
+	var regs []*ast.Register
+	switch stmt := stmt.(type) {
+	case *ast.ThreeRegisterStatement:
+		regs = []*ast.Register{stmt.DataRegister, stmt.SourceRegisters[0], stmt.SourceRegisters[1]}
+	case *ast.TwoRegisterImmediate:
+		regs = []*ast.Register{stmt.DataRegister, stmt.SourceRegister}
+	case *ast.TwoRegister:
+		regs = []*ast.Register{stmt.DataRegister, stmt.SourceRegister}
+	case *ast.RegisterLabelStatement:
+		regs = []*ast.Register{stmt.Register}
+	case *ast.TwoRegisterOffset:
+		regs = []*ast.Register{stmt.LeftRegister, stmt.RightRegister}
+	case *ast.OneRegister:
+		regs = []*ast.Register{stmt.Register}
+	}
+
+	for i := range regs {
+		reg := regs[i]
+		if read {
+			reg = regs[len(regs)-1-i]
+		}
+		if reg.ID == r {
+			return reg.Pos()
+		}
+	}
+	return stmt.Pos()
+}
@@ -0,0 +1,230 @@
+// Package lint looks for mistakes in assembly programs that assemble
+// without complaint but are unlikely to do what was meant.
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"lc3asm-parser/ast"
+	"lc3asm-parser/dataflow"
+	"lc3asm-parser/token"
+)
+
+// Severity is how likely a finding is to be a real problem.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Rule IDs, one per kind of finding.
+const (
+	MissingHalt    = "missing-halt"    // No HALT before execution reaches data or the end
+	FallThrough    = "fall-through"    // Execution runs on into data or off the end
+	UnusedLabel    = "unused-label"    // A label nothing refers to
+	UndefinedLabel = "undefined-label" // A reference to a label never defined
+	UnsavedR7      = "unsaved-r7"      // R7 read after a JSR or TRAP replaced it
+	BareBranch     = "bare-br"         // BR without condition codes, which always branches
+	CodeAfterEnd   = "code-after-end"  // Statements the assembler ignores after .END
+
+	UninitializedRead = "uninitialized-read" // A register read before anything wrote it
+	DeadWrite         = "dead-write"         // A value written and never read
+	UndefinedCC       = "undefined-cc"       // A branch on condition codes from routine entry or a call
+)
+
+// Finding is one problem found by Check.
+type Finding struct {
+	Rule     string
+	Severity Severity
+	Pos      token.Position
+	Msg      string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", f.Pos, f.Severity, f.Msg, f.Rule)
+}
+
+// Check runs every rule over program and returns the findings ordered by
+// position. The dataflow rules only run when the program assembles.
+func Check(program *ast.Program) []Finding {
+	c := &checker{}
+
+	c.statements = program.Statements
+	for i, stmt := range program.Statements {
+		if _, ok := stmt.(*ast.EndDirective); ok {
+			c.statements = program.Statements[:i]
+			if i+1 < len(program.Statements) {
+				c.report(CodeAfterEnd, Warning, program.Statements[i+1].Pos(),
+					"statements after .END are ignored by the assembler")
+			}
+			break
+		}
+	}
+
+	c.checkFlow()
+	c.checkLabels()
+	c.checkR7()
+	c.checkBranches()
+	c.checkDataflow(program)
+
+	sort.SliceStable(c.findings, func(i, j int) bool {
+		return c.findings[i].Pos.Offset < c.findings[j].Pos.Offset
+	})
+	return c.findings
+}
+
+type checker struct {
+	statements []ast.Statement // The statements before .END
+	findings   []Finding
+}
+
+func (c *checker) report(rule string, severity Severity, pos token.Position, format string, args ...interface{}) {
+	c.findings = append(c.findings, Finding{Rule: rule, Severity: severity, Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// checkFlow reports data and the end of the program reached by running
+// on from the instruction before. Before the first HALT this is reported
+// as a missing HALT.
+func (c *checker) checkFlow() {
+	var last ast.Statement // Last instruction or data directive
+	halted := false
+
+	fallsInto := func() bool {
+		return last != nil && !ast.IsData(last) && !endsFlow(last)
+	}
+	report := func(pos token.Position, into string) {
+		if halted {
+			c.report(FallThrough, Warning, pos, "execution falls through into %s", into)
+		} else {
+			c.report(MissingHalt, Warning, pos, "no HALT before execution reaches %s", into)
+		}
+	}
+
+	for _, stmt := range c.statements {
+		switch stmt.(type) {
+		case *ast.Label, *ast.BeginDirective:
+			continue
+		case *ast.OrigDirective:
+			last = nil
+			continue
+		}
+
+		if ast.IsData(stmt) && fallsInto() {
+			report(stmt.Pos(), "data")
+		}
+		if isHalt(stmt) {
+			halted = true
+		}
+		last = stmt
+	}
+
+	if fallsInto() {
+		report(last.Pos(), "the end of the program")
+	}
+}
+
+// checkLabels reports labels that are defined but never used and labels
+// that are used but never defined.
+func (c *checker) checkLabels() {
+	defined := make(map[string]bool)
+	used := make(map[string]bool)
+	for _, stmt := range c.statements {
+		if label, ok := stmt.(*ast.Label); ok {
+			defined[label.Value] = true
+		} else if ref := ast.LabelReference(stmt); ref != nil {
+			used[ref.Value] = true
+		}
+	}
+
+	for _, stmt := range c.statements {
+		if label, ok := stmt.(*ast.Label); ok {
+			if !used[label.Value] {
+				c.report(UnusedLabel, Info, label.Pos(), "label %s is never used", label.Value)
+			}
+		} else if ref := ast.LabelReference(stmt); ref != nil && !defined[ref.Value] {
+			c.report(UndefinedLabel, Error, ref.Pos(), "label %s is not defined", ref.Value)
+		}
+	}
+}
+
+// checkR7 follows the program in order and reports reads of R7 after a
+// JSR, JSRR or TRAP has replaced it with its own return address, unless
+// R7 was written again first. Tracking restarts after instructions that
+// never fall through, since what follows them is reached some other way.
+func (c *checker) checkR7() {
+	var call ast.Statement // Last call that replaced R7, if any
+
+	for _, stmt := range c.statements {
+		if call != nil && dataflow.Reads(stmt).Has(7) {
+			c.report(UnsavedR7, Warning, stmt.Pos(),
+				"R7 read after %s at %s replaced it; save R7 before the call and restore it after",
+				opcodeName(call), call.Pos())
+			call = nil
+		}
+
+		switch {
+		case dataflow.IsCall(stmt):
+			call = stmt
+		case dataflow.Writes(stmt).Has(7), endsFlow(stmt), ast.IsData(stmt):
+			call = nil
+		}
+		if _, ok := stmt.(*ast.OrigDirective); ok {
+			call = nil
+		}
+	}
+}
+
+// checkBranches reports BR written without condition codes.
+func (c *checker) checkBranches() {
+	for _, stmt := range c.statements {
+		if br, ok := stmt.(*ast.BranchStatement); ok && !br.N && !br.Z && !br.P {
+			c.report(BareBranch, Warning, br.Pos(), "BR without condition codes always branches; write BRnzp")
+		}
+	}
+}
+
+func isHalt(stmt ast.Statement) bool {
+	trap, ok := stmt.(*ast.TrapStatement)
+	return ok && trap.Vector.Value == token.TrapVectors["HALT"]
+}
+
+// endsFlow reports whether execution never continues with the statement
+// after stmt.
+func endsFlow(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.BranchStatement:
+		return stmt.N == stmt.Z && stmt.Z == stmt.P
+	case *ast.OneRegister:
+		return stmt.Opcode.Literal == "JMP"
+	case *ast.NoOperand:
+		return true
+	}
+	return isHalt(stmt)
+}
+
+func opcodeName(stmt ast.Statement) string {
+	switch stmt := stmt.(type) {
+	case *ast.SubroutineStatement:
+		return stmt.Opcode.Literal
+	case *ast.OneRegister:
+		return stmt.Opcode.Literal
+	case *ast.TrapStatement:
+		return stmt.Opcode.Literal
+	}
+	return stmt.TokenLiteral()
+}
@@ -0,0 +1,128 @@
+package lint
+
+import (
+	"testing"
+
+	"lc3asm-parser/ast"
+	"lc3asm-parser/lc3os"
+	"lc3asm-parser/lexer"
+	"lc3asm-parser/parser"
+)
+
+func TestCheck(t *testing.T) {
+	input := `	.ORIG x3000
+	LEA R0,MSG
+	PUTS
+	JSR SUB
+	BR NOWHERE
+MSG	.STRINGZ "hi"
+SUB	AND R1,R1,#0
+	OUT
+	RET
+UNUSED	ADD R1,R1,#1
+DATA	.FILL #1
+	HALT
+	LD R1,DATA
+	.END
+	ADD R1,R1,#1`
+
+	tests := []struct {
+		rule     string
+		severity Severity
+		line     int
+	}{
+		{BareBranch, Warning, 5},
+		{UndefinedLabel, Error, 5},
+		{UnsavedR7, Warning, 9},
+		{UnusedLabel, Info, 10},
+		{MissingHalt, Warning, 11},
+		{FallThrough, Warning, 13},
+		{CodeAfterEnd, Warning, 15},
+	}
+
+	findings := Check(parse(t, input))
+	if len(findings) != len(tests) {
+		t.Fatalf("wrong number of findings. expected=%d, got=%d: %v", len(tests), len(findings), findings)
+	}
+	for i, tt := range tests {
+		f := findings[i]
+		if f.Rule != tt.rule || f.Severity != tt.severity || f.Pos.Line != tt.line {
+			t.Errorf("tests[%d] - finding wrong. expected=%s %s at line %d, got=%s", i, tt.rule, tt.severity, tt.line, f)
+		}
+	}
+}
+
+func TestSavedR7(t *testing.T) {
+	input := `	.ORIG x3000
+	JSR SUB
+	HALT
+SUB	ST R7,SAVE
+	OUT
+	LD R7,SAVE
+	RET
+SAVE	.BLKW 1
+	.END`
+
+	if findings := Check(parse(t, input)); len(findings) != 0 {
+		t.Errorf("expected no findings, got=%v", findings)
+	}
+}
+
+func TestDataflow(t *testing.T) {
+	input := `	.ORIG x3000
+	BRz START
+START	AND R1,R1,#0
+	ADD R2,R3,#1
+	LD R4,TEN
+	LD R4,TEN
+LOOP	GETC
+	BRz DONE
+	ADD R1,R1,R4
+	ADD R4,R4,#-1
+	BRp LOOP
+	ADD R5,R5,#1
+DONE	ADD R6,R5,#0
+	HALT
+TEN	.FILL #10
+	.END`
+
+	tests := []struct {
+		rule   string
+		line   int
+		column int
+	}{
+		{UndefinedCC, 2, 2},
+		{UninitializedRead, 4, 9},
+		{DeadWrite, 5, 5},
+		{UndefinedCC, 8, 2},
+		{UninitializedRead, 12, 9},
+		{UninitializedRead, 13, 13},
+	}
+
+	findings := Check(parse(t, input))
+	if len(findings) != len(tests) {
+		t.Fatalf("wrong number of findings. expected=%d, got=%d: %v", len(tests), len(findings), findings)
+	}
+	for i, tt := range tests {
+		f := findings[i]
+		if f.Rule != tt.rule || f.Pos.Line != tt.line || f.Pos.Column != tt.column {
+			t.Errorf("tests[%d] - finding wrong. expected=%s at %d:%d, got=%s", i, tt.rule, tt.line, tt.column, f)
+		}
+	}
+}
+
+func TestOperatingSystem(t *testing.T) {
+	if findings := Check(parse(t, lc3os.Source)); len(findings) != 0 {
+		t.Errorf("expected no findings, got=%v", findings)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
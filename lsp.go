@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"lc3asm-parser/lsp"
+)
+
+// languageServer implements `lsp`, serving the Language Server Protocol
+// over standard input and output.
+func languageServer(args []string) error {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return errors.New("usage: lsp")
+	}
+	return lsp.NewServer(os.Stdin, os.Stdout).Run()
+}
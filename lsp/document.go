@@ -0,0 +1,279 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/ast"
+	"lc3asm-parser/disasm"
+	"lc3asm-parser/lexer"
+	"lc3asm-parser/lint"
+	"lc3asm-parser/parser"
+	"lc3asm-parser/token"
+)
+
+// document is an open file and what is known about it. It is analyzed
+// once per change.
+type document struct {
+	uri   string
+	text  string
+	lines []string
+
+	program     *ast.Program
+	obj         *assembler.Object // Nil unless the program assembles
+	diagnostics []Diagnostic
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text, lines: strings.Split(text, "\n")}
+
+	p := parser.New(lexer.New(text))
+	d.program = p.ParseProgram()
+	for _, e := range p.Errors() {
+		d.diagnose(e.Pos, SeverityError, "", e.Msg)
+	}
+	if len(p.Errors()) > 0 {
+		return d
+	}
+
+	a := assembler.New(d.program)
+	obj := a.Assemble()
+	for _, e := range a.Errors() {
+		d.diagnose(e.Pos, SeverityError, "", e.Msg)
+	}
+	if len(a.Errors()) == 0 {
+		d.obj = obj
+	}
+
+	severities := map[lint.Severity]int{
+		lint.Error:   SeverityError,
+		lint.Warning: SeverityWarning,
+		lint.Info:    SeverityInformation,
+	}
+	for _, f := range lint.Check(d.program) {
+		// The assembler has already reported these
+		if f.Rule == lint.UndefinedLabel {
+			continue
+		}
+		d.diagnose(f.Pos, severities[f.Severity], f.Rule, f.Msg)
+	}
+	return d
+}
+
+func (d *document) diagnose(pos token.Position, severity int, code, msg string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    d.wordRange(pos),
+		Severity: severity,
+		Code:     code,
+		Source:   "lc3",
+		Message:  msg,
+	})
+}
+
+// wordRange returns the range of the word starting at pos, so that an
+// error is underlined along the token it is about. A position that is
+// not set stands for the start of the document.
+func (d *document) wordRange(pos token.Position) Range {
+	if !pos.IsValid() {
+		return Range{}
+	}
+
+	start := position(pos)
+	end := start
+	if start.Line < len(d.lines) {
+		line := d.lines[start.Line]
+		for end.Character < len(line) && isWordChar(line[end.Character]) {
+			end.Character++
+		}
+		if end == start && end.Character < len(line) {
+			end.Character++
+		}
+	}
+	return Range{Start: start, End: end}
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || ch == '#' || ch == '.' || ch == '-' ||
+		'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9'
+}
+
+// position converts a source position to a protocol one.
+func position(pos token.Position) Position {
+	return Position{Line: pos.Line - 1, Character: pos.Column - 1}
+}
+
+// tokenRange returns the range covered by tok.
+func tokenRange(tok token.Token) Range {
+	return Range{Start: position(tok.Pos), End: position(tok.End)}
+}
+
+func contains(r Range, p Position) bool {
+	if p.Line != r.Start.Line {
+		return false
+	}
+	return r.Start.Character <= p.Character && p.Character <= r.End.Character
+}
+
+// labelAt returns the label, defined or referred to, under p.
+func (d *document) labelAt(p Position) (*ast.Label, bool) {
+	for _, stmt := range d.program.Statements {
+		label, ok := stmt.(*ast.Label)
+		if !ok {
+			label = ast.LabelReference(stmt)
+		}
+		if label != nil && contains(tokenRange(label.Token), p) {
+			return label, true
+		}
+	}
+	return nil, false
+}
+
+// definition returns the statement defining the label called name.
+func (d *document) definition(name string) (*ast.Label, bool) {
+	for _, stmt := range d.program.Statements {
+		if label, ok := stmt.(*ast.Label); ok && label.Value == name {
+			return label, true
+		}
+	}
+	return nil, false
+}
+
+// references returns the uses of the label called name, with its
+// definition first when declaration is set.
+func (d *document) references(name string, declaration bool) []*ast.Label {
+	var labels []*ast.Label
+	for _, stmt := range d.program.Statements {
+		if label, ok := stmt.(*ast.Label); ok {
+			if declaration && label.Value == name {
+				labels = append(labels, label)
+			}
+		} else if ref := ast.LabelReference(stmt); ref != nil && ref.Value == name {
+			labels = append(labels, ref)
+		}
+	}
+	return labels
+}
+
+// hover describes what is under p: the address of a label, or the
+// address and encoding of the statement on the line.
+func (d *document) hover(p Position) (*Hover, bool) {
+	if label, ok := d.labelAt(p); ok {
+		text := fmt.Sprintf("`%s`", label.Value)
+		if d.obj != nil {
+			if sym, ok := d.obj.Symbols.Resolve(label.Value); ok {
+				text += fmt.Sprintf(" x%04X", sym.Address)
+			}
+		}
+		r := tokenRange(label.Token)
+		return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}, true
+	}
+
+	if d.obj == nil {
+		return nil, false
+	}
+	for _, rec := range d.obj.Records {
+		if rec.Statement.Pos().Line-1 != p.Line {
+			continue
+		}
+
+		var text string
+		if len(rec.Words) == 1 {
+			word := rec.Words[0]
+			text = fmt.Sprintf("```lc3\n%s\n```\nx%04X: x%04X `%s`", disasm.Disassemble(rec.Address, word,
+				disasm.SymbolLabels(d.obj.Symbols)), rec.Address, word, binary(word))
+		} else {
+			text = fmt.Sprintf("x%04X-x%04X: %d words", rec.Address, rec.Address+uint16(len(rec.Words))-1, len(rec.Words))
+		}
+		return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}}, true
+	}
+	return nil, false
+}
+
+// binary writes word in groups of four bits.
+func binary(word uint16) string {
+	s := fmt.Sprintf("%016b", word)
+	return s[0:4] + " " + s[4:8] + " " + s[8:12] + " " + s[12:16]
+}
+
+// completions returns the keywords and the labels of the document.
+func (d *document) completions() []CompletionItem {
+	var items []CompletionItem
+	for _, kw := range token.Keywords() {
+		switch kw.Type {
+		case token.OPCODE:
+			items = append(items, CompletionItem{Label: kw.Word, Kind: CompletionKeyword, Detail: "opcode"})
+		case token.TRAP:
+			detail := "trap"
+			if vector, ok := token.TrapVectors[kw.Word]; ok {
+				detail = fmt.Sprintf("TRAP x%02X", vector)
+			}
+			items = append(items, CompletionItem{Label: kw.Word, Kind: CompletionFunction, Detail: detail})
+		case token.DIRECTIVE:
+			items = append(items, CompletionItem{
+				Label: "." + kw.Word, Kind: CompletionKeyword, Detail: "directive",
+				InsertText: kw.Word, FilterText: kw.Word,
+			})
+		case token.REGISTER:
+			items = append(items, CompletionItem{Label: kw.Word, Kind: CompletionVariable, Detail: "register"})
+		}
+	}
+
+	for _, stmt := range d.program.Statements {
+		if label, ok := stmt.(*ast.Label); ok {
+			items = append(items, CompletionItem{Label: label.Value, Kind: CompletionReference, Detail: d.address(label.Value)})
+		}
+	}
+	return items
+}
+
+// symbols returns the labels of the document. Subroutines are labels
+// used by JSR and variables are labels of data.
+func (d *document) symbols() []DocumentSymbol {
+	called := make(map[string]bool)
+	for _, stmt := range d.program.Statements {
+		if jsr, ok := stmt.(*ast.SubroutineStatement); ok && jsr.Label != nil {
+			called[jsr.Label.Value] = true
+		}
+	}
+
+	var symbols []DocumentSymbol
+	for i, stmt := range d.program.Statements {
+		label, ok := stmt.(*ast.Label)
+		if !ok {
+			continue
+		}
+
+		kind := SymbolConstant
+		if called[label.Value] {
+			kind = SymbolFunction
+		} else if i+1 < len(d.program.Statements) && ast.IsData(d.program.Statements[i+1]) {
+			kind = SymbolVariable
+		}
+
+		line := label.Pos().Line - 1
+		full := Range{Start: Position{Line: line}, End: Position{Line: line}}
+		if line < len(d.lines) {
+			full.End.Character = len(strings.TrimRight(d.lines[line], "\r"))
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           label.Value,
+			Detail:         d.address(label.Value),
+			Kind:           kind,
+			Range:          full,
+			SelectionRange: tokenRange(label.Token),
+		})
+	}
+	return symbols
+}
+
+// address returns the address of a label as x3000, or "" if unknown.
+func (d *document) address(name string) string {
+	if d.obj == nil {
+		return ""
+	}
+	if sym, ok := d.obj.Symbols.Resolve(name); ok {
+		return fmt.Sprintf("x%04X", sym.Address)
+	}
+	return ""
+}
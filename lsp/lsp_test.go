@@ -0,0 +1,329 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"lc3asm-parser/wire"
+)
+
+const uri = "file:///test.asm"
+
+const source = `	.ORIG x3000
+	LEA R0,MSG
+	PUTS
+	JSR SUB
+	HALT
+SUB	ADD R1,R1,#1
+	RET
+MSG	.STRINGZ "hi"
+	.END
+`
+
+// session runs the server over the messages given and returns what it
+// wrote: responses by id and notifications in order.
+func session(t *testing.T, messages ...interface{}) (map[int]json.RawMessage, []notification) {
+	t.Helper()
+
+	var in bytes.Buffer
+	w := wire.NewWriter(&in)
+	for _, m := range messages {
+		if err := w.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	responses := make(map[int]json.RawMessage)
+	var notifications []notification
+	r := wire.NewReader(&out)
+	for {
+		body, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *Error          `json:"error"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case msg.ID == nil:
+			notifications = append(notifications, notification{Method: msg.Method, Params: msg.Params})
+		case msg.Error != nil:
+			responses[*msg.ID], _ = json.Marshal(msg.Error)
+		default:
+			responses[*msg.ID] = msg.Result
+		}
+	}
+	return responses, notifications
+}
+
+func call(id int, method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notify(method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func open(text string) map[string]interface{} {
+	return notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "lc3", Version: 1, Text: text},
+	})
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func exit() []interface{} {
+	return []interface{}{call(99, "shutdown", nil), notify("exit", nil)}
+}
+
+func decode(t *testing.T, raw json.RawMessage, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(raw, v); err != nil {
+		t.Fatalf("cannot decode %s: %v", raw, err)
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	responses, _ := session(t, append([]interface{}{
+		call(1, "initialize", map[string]interface{}{}),
+		notify("initialized", map[string]interface{}{}),
+		call(2, "textDocument/unknown", nil),
+	}, exit()...)...)
+
+	var result struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	decode(t, responses[1], &result)
+	for _, c := range []string{"definitionProvider", "referencesProvider", "hoverProvider", "documentSymbolProvider", "completionProvider"} {
+		if result.Capabilities[c] == nil {
+			t.Errorf("capability %s missing", c)
+		}
+	}
+
+	var e Error
+	decode(t, responses[2], &e)
+	if e.Code != codeMethodNotFound {
+		t.Errorf("unknown method answered with %s", responses[2])
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	var in, out bytes.Buffer
+	wire.NewWriter(&in).Write(notify("exit", nil))
+	if err := NewServer(&in, &out).Run(); err == nil {
+		t.Errorf("exit without shutdown not reported")
+	}
+}
+
+func TestMalformedMessages(t *testing.T) {
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"jsonrpc": "2.0", "id": 1,`, codeParseError},
+		{`not json`, codeParseError},
+		{`[1, 2]`, codeInvalidRequest},
+		{`{"jsonrpc": "2.0", "id": 1, "method": 5}`, codeInvalidRequest},
+		{`{"jsonrpc": "2.0", "id": 1}`, codeInvalidRequest},
+	}
+
+	for i, tt := range tests {
+		var in, out bytes.Buffer
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(tt.body), tt.body)
+		if err := NewServer(&in, &out).Run(); err != nil {
+			t.Fatalf("tests[%d] - Run failed: %v", i, err)
+		}
+
+		body, err := wire.NewReader(&out).Read()
+		if err != nil {
+			t.Fatalf("tests[%d] - no response: %v", i, err)
+		}
+		var resp errorResponse
+		decode(t, body, &resp)
+		if resp.Error == nil || resp.Error.Code != tt.code {
+			t.Errorf("tests[%d] - error code wrong. expected=%d, got=%s", i, tt.code, body)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	changed := strings.Replace(source, "JSR SUB", "JSR SUBB", 1)
+	_, notifications := session(t, append([]interface{}{
+		open(source),
+		notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []map[string]string{{"text": changed}},
+		}),
+		notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 3},
+			"contentChanges": []map[string]string{{"text": "\tADD R1,R2\n"}},
+		}),
+		notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}}),
+	}, exit()...)...)
+
+	if len(notifications) != 4 {
+		t.Fatalf("wrong number of notifications. expected=4, got=%d", len(notifications))
+	}
+	var published [4]PublishDiagnosticsParams
+	for i, n := range notifications {
+		if n.Method != "textDocument/publishDiagnostics" {
+			t.Fatalf("notifications[%d] - method wrong. got=%q", i, n.Method)
+		}
+		decode(t, n.Params.(json.RawMessage), &published[i])
+	}
+
+	if len(published[0].Diagnostics) != 0 {
+		t.Errorf("clean source has diagnostics: %+v", published[0].Diagnostics)
+	}
+
+	// The undefined label is reported once, by the assembler, and SUB
+	// is now unused
+	diags := published[1].Diagnostics
+	if len(diags) != 2 {
+		t.Fatalf("wrong number of diagnostics. expected=2, got=%+v", diags)
+	}
+	want := Range{Start: Position{Line: 3, Character: 5}, End: Position{Line: 3, Character: 9}}
+	if diags[0].Severity != SeverityError || diags[0].Range != want || !strings.Contains(diags[0].Message, "SUBB") {
+		t.Errorf("undefined label diagnostic wrong: %+v", diags[0])
+	}
+	if diags[1].Severity != SeverityInformation || diags[1].Code != "unused-label" {
+		t.Errorf("unused label diagnostic wrong: %+v", diags[1])
+	}
+
+	if diags := published[2].Diagnostics; len(diags) == 0 || diags[0].Severity != SeverityError {
+		t.Errorf("parse error diagnostic wrong: %+v", diags)
+	}
+	if len(published[3].Diagnostics) != 0 {
+		t.Errorf("closing did not clear diagnostics")
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	responses, _ := session(t, append([]interface{}{
+		open(source),
+		call(1, "textDocument/definition", at(3, 6)),
+		call(2, "textDocument/references", ReferenceParams{TextDocumentPositionParams: at(5, 1)}),
+		call(3, "textDocument/references", map[string]interface{}{
+			"textDocument": TextDocumentIdentifier{URI: uri},
+			"position":     Position{Line: 7, Character: 0},
+			"context":      map[string]bool{"includeDeclaration": true},
+		}),
+		call(4, "textDocument/definition", at(2, 2)),
+	}, exit()...)...)
+
+	var def Location
+	decode(t, responses[1], &def)
+	if def.URI != uri || def.Range != (Range{Start: Position{Line: 5}, End: Position{Line: 5, Character: 3}}) {
+		t.Errorf("definition wrong: %+v", def)
+	}
+
+	var refs []Location
+	decode(t, responses[2], &refs)
+	if len(refs) != 1 || refs[0].Range.Start != (Position{Line: 3, Character: 5}) {
+		t.Errorf("references of SUB wrong: %+v", refs)
+	}
+
+	decode(t, responses[3], &refs)
+	if len(refs) != 2 || refs[0].Range.Start.Line != 1 || refs[1].Range.Start.Line != 7 {
+		t.Errorf("references of MSG wrong: %+v", refs)
+	}
+
+	if string(responses[4]) != "null" {
+		t.Errorf("definition outside a label wrong: %s", responses[4])
+	}
+}
+
+func TestHover(t *testing.T) {
+	responses, _ := session(t, append([]interface{}{
+		open(source),
+		call(1, "textDocument/hover", at(5, 1)),
+		call(2, "textDocument/hover", at(5, 6)),
+		call(3, "textDocument/hover", at(7, 6)),
+		call(4, "textDocument/hover", at(0, 2)),
+	}, exit()...)...)
+
+	tests := []struct {
+		id   int
+		want []string
+	}{
+		{1, []string{"SUB", "x3004"}},
+		{2, []string{"ADD R1, R1, #1", "x3004: x1261", "0001 0010 0110 0001"}},
+		{3, []string{"x3006-x3008: 3 words"}},
+	}
+	for _, tt := range tests {
+		var h Hover
+		decode(t, responses[tt.id], &h)
+		for _, want := range tt.want {
+			if !strings.Contains(h.Contents.Value, want) {
+				t.Errorf("hover %d - %q missing from %q", tt.id, want, h.Contents.Value)
+			}
+		}
+	}
+
+	if string(responses[4]) != "null" {
+		t.Errorf("hover on .ORIG wrong: %s", responses[4])
+	}
+}
+
+func TestCompletionAndSymbols(t *testing.T) {
+	responses, _ := session(t, append([]interface{}{
+		open(source),
+		call(1, "textDocument/completion", at(4, 1)),
+		call(2, "textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}),
+	}, exit()...)...)
+
+	var items []CompletionItem
+	decode(t, responses[1], &items)
+	labels := make(map[string]CompletionItem)
+	for _, item := range items {
+		labels[item.Label] = item
+	}
+	for _, want := range []string{"ADD", "BRnzp", "PUTS", ".STRINGZ", "R7", "SUB", "MSG"} {
+		if _, ok := labels[want]; !ok {
+			t.Errorf("completion %q missing", want)
+		}
+	}
+	if labels["HALT"].Detail != "TRAP x25" {
+		t.Errorf("HALT detail wrong. got=%q", labels["HALT"].Detail)
+	}
+	if labels["MSG"].Detail != "x3006" {
+		t.Errorf("MSG detail wrong. got=%q", labels["MSG"].Detail)
+	}
+
+	var symbols []DocumentSymbol
+	decode(t, responses[2], &symbols)
+	if len(symbols) != 2 {
+		t.Fatalf("wrong number of symbols. expected=2, got=%+v", symbols)
+	}
+	if symbols[0].Name != "SUB" || symbols[0].Kind != SymbolFunction || symbols[0].Detail != "x3004" {
+		t.Errorf("symbols[0] wrong: %+v", symbols[0])
+	}
+	if symbols[1].Name != "MSG" || symbols[1].Kind != SymbolVariable {
+		t.Errorf("symbols[1] wrong: %+v", symbols[1])
+	}
+}
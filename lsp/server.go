@@ -0,0 +1,264 @@
+// Package lsp is a Language Server Protocol server for LC-3 assembly. It
+// reports parser, assembler and lint diagnostics, finds the definition
+// and uses of labels, shows addresses and encodings on hover, completes
+// keywords and labels and lists the labels of a file as its symbols.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"lc3asm-parser/wire"
+)
+
+// Server answers one client over a pair of streams.
+type Server struct {
+	in       *wire.Reader
+	out      *wire.Writer
+	docs     map[string]*document
+	shutdown bool
+	handlers map[string]func(s *Server, params json.RawMessage) (interface{}, error)
+}
+
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{
+		in:   wire.NewReader(r),
+		out:  wire.NewWriter(w),
+		docs: make(map[string]*document),
+		handlers: map[string]func(s *Server, params json.RawMessage) (interface{}, error){
+			"initialize":                  (*Server).initialize,
+			"initialized":                 (*Server).ignore,
+			"shutdown":                    (*Server).shutdownRequest,
+			"textDocument/didOpen":        (*Server).didOpen,
+			"textDocument/didChange":      (*Server).didChange,
+			"textDocument/didClose":       (*Server).didClose,
+			"textDocument/definition":     (*Server).definition,
+			"textDocument/references":     (*Server).references,
+			"textDocument/hover":          (*Server).hover,
+			"textDocument/completion":     (*Server).completion,
+			"textDocument/documentSymbol": (*Server).documentSymbol,
+			"$/cancelRequest":             (*Server).ignore,
+			"$/setTrace":                  (*Server).ignore,
+		},
+	}
+}
+
+// Run serves requests until the client sends exit or closes the input.
+// Exiting without a shutdown request first is an error.
+func (s *Server) Run() error {
+	for {
+		body, err := s.in.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Bodies that are not JSON at all are told apart from JSON that is
+		// not a request
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil || req.Method == "" {
+			e := &Error{Code: codeInvalidRequest, Message: "invalid request"}
+			if !json.Valid(body) {
+				e = &Error{Code: codeParseError, Message: err.Error()}
+			}
+			if err := s.reply(nil, nil, e); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+
+		handler, ok := s.handlers[req.Method]
+		if !ok {
+			// Unknown notifications are ignored
+			if req.ID != nil {
+				err = &Error{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+				if err := s.reply(req.ID, nil, err); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		result, err := handler(s, req.Params)
+		if req.ID != nil {
+			if err := s.reply(req.ID, result, err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, err error) error {
+	if err != nil {
+		e, ok := err.(*Error)
+		if !ok {
+			e = &Error{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return s.out.Write(errorResponse{JSONRPC: "2.0", ID: id, Error: e})
+	}
+	return s.out.Write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return s.out.Write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) initialize(json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":       1, // Full
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"hoverProvider":          true,
+			"documentSymbolProvider": true,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"."},
+			},
+		},
+		"serverInfo": map[string]string{"name": "lc3"},
+	}, nil
+}
+
+func (s *Server) ignore(json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics",
+		PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+// update analyzes the new text of a document and publishes its
+// diagnostics.
+func (s *Server) update(uri, text string) error {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+
+	diagnostics := d.diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// document decodes position params and returns the document they name.
+func (s *Server) document(params json.RawMessage, p interface{}, uri func() string) (*document, error) {
+	if err := json.Unmarshal(params, p); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[uri()]
+	if !ok {
+		return nil, &Error{Code: codeInvalidParams, Message: "document not open: " + uri()}
+	}
+	return d, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	d, err := s.document(params, &p, func() string { return p.TextDocument.URI })
+	if err != nil {
+		return nil, err
+	}
+
+	label, ok := d.labelAt(p.Position)
+	if !ok {
+		return nil, nil
+	}
+	def, ok := d.definition(label.Value)
+	if !ok {
+		return nil, nil
+	}
+	return Location{URI: d.uri, Range: tokenRange(def.Token)}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	d, err := s.document(params, &p, func() string { return p.TextDocument.URI })
+	if err != nil {
+		return nil, err
+	}
+
+	label, ok := d.labelAt(p.Position)
+	if !ok {
+		return nil, nil
+	}
+	locations := []Location{}
+	for _, ref := range d.references(label.Value, p.Context.IncludeDeclaration) {
+		locations = append(locations, Location{URI: d.uri, Range: tokenRange(ref.Token)})
+	}
+	return locations, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	d, err := s.document(params, &p, func() string { return p.TextDocument.URI })
+	if err != nil {
+		return nil, err
+	}
+
+	if h, ok := d.hover(p.Position); ok {
+		return h, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	d, err := s.document(params, &p, func() string { return p.TextDocument.URI })
+	if err != nil {
+		return nil, err
+	}
+	return d.completions(), nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	d, err := s.document(params, &p, func() string { return p.TextDocument.URI })
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := d.symbols()
+	if symbols == nil {
+		symbols = []DocumentSymbol{}
+	}
+	return symbols, nil
+}
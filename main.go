@@ -7,7 +7,34 @@ import (
 	"os/user"
 )
 
+// commands are the subcommands selected by the first argument. Without
+// one the REPL is started.
+var commands = map[string]func(args []string) error{
+	"asm":    assemble,
+	"run":    runProgram,
+	"debug":  debugProgram,
+	"disasm": disassemble,
+	"fmt":    formatFiles,
+	"lint":   lintFiles,
+	"cfg":    controlFlow,
+	"lsp":    languageServer,
+	"dap":    debugAdapter,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+		if err := command(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
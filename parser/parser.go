@@ -0,0 +1,555 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"lc3asm-parser/ast"
+	"lc3asm-parser/lexer"
+	"lc3asm-parser/token"
+)
+
+// Error is a problem found while parsing, located at Pos.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorList is a list of parser errors, in the order found.
+type ErrorList []Error
+
+func (el ErrorList) Error() string {
+	msgs := make([]string, len(el))
+	for i, e := range el {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+type Parser struct {
+	l        *lexer.Lexer
+	errors   []Error
+	comments []*ast.Comment
+
+	curToken  token.Token
+	peekToken token.Token
+}
+
+func New(l *lexer.Lexer) *Parser {
+	p := &Parser{l: l}
+
+	// Read two tokens, so curToken and peekToken are both set
+	p.nextToken()
+	p.nextToken()
+
+	return p
+}
+
+func (p *Parser) Errors() []Error {
+	return p.errors
+}
+
+// nextToken advances to the next significant token. Indentation and
+// comments carry no meaning for the assembler and are skipped, though
+// comments are kept for Program.Comments.
+func (p *Parser) nextToken() {
+	p.curToken = p.peekToken
+	p.peekToken = p.l.NextToken()
+	for isTrivia(p.peekToken.Type) {
+		if p.peekToken.Type == token.COMMENT || p.peekToken.Type == token.SEMICOLON {
+			p.comments = append(p.comments, &ast.Comment{Token: p.peekToken, Text: p.peekToken.Literal})
+		}
+		p.peekToken = p.l.NextToken()
+	}
+}
+
+func isTrivia(t token.TokenType) bool {
+	switch t {
+	case token.INDENT, token.DEDENT, token.COMMENT, token.SEMICOLON:
+		return true
+	}
+	return false
+}
+
+func (p *Parser) ParseProgram() *ast.Program {
+	program := &ast.Program{}
+	program.Statements = []ast.Statement{}
+
+	for p.curToken.Type != token.EOF {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+			if _, ok := stmt.(*ast.Label); !ok {
+				p.expectEndOfLine()
+			}
+		} else {
+			p.skipLine()
+		}
+		p.nextToken()
+	}
+
+	program.Comments = p.comments
+	attachTrivia(program)
+	return program
+}
+
+// attachTrivia fills in program.Trivia and program.EndComments from the
+// lines its statements and comments were found on.
+func attachTrivia(program *ast.Program) {
+	program.Trivia = make(map[ast.Statement]*ast.Trivia)
+	comments := program.Comments
+	last := 0 // Last line holding a statement or comment
+
+	blank := func(line int) bool {
+		return last > 0 && line > last+1
+	}
+
+	for i, stmt := range program.Statements {
+		trivia := &ast.Trivia{}
+		program.Trivia[stmt] = trivia
+		line := stmt.Pos().Line
+
+		if i == 0 || program.Statements[i-1].Pos().Line != line {
+			for len(comments) > 0 && comments[0].Pos().Line < line {
+				comments[0].BlankBefore = blank(comments[0].Pos().Line)
+				trivia.Leading = append(trivia.Leading, comments[0])
+				last = comments[0].Pos().Line
+				comments = comments[1:]
+			}
+			trivia.BlankBefore = blank(line)
+		}
+
+		lastOnLine := i+1 == len(program.Statements) || program.Statements[i+1].Pos().Line != line
+		if lastOnLine && len(comments) > 0 && comments[0].Pos().Line == line {
+			trivia.Trailing = comments[0]
+			comments = comments[1:]
+		}
+		last = line
+	}
+
+	for _, c := range comments {
+		c.BlankBefore = blank(c.Pos().Line)
+		last = c.Pos().Line
+	}
+	program.EndComments = comments
+}
+
+func (p *Parser) parseStatement() ast.Statement {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return p.parseLabelDefinition()
+	case token.OPCODE:
+		return p.parseInstruction()
+	case token.TRAP:
+		return p.parseTrapStatement()
+	case token.PERIOD:
+		return p.parseDirective()
+	case token.ILLEGAL:
+		p.illegal(p.curToken)
+		return nil
+	default:
+		p.errorf(p.curToken.Pos, "unexpected %s %q at start of statement", p.curToken.Type, p.curToken.Literal)
+		return nil
+	}
+}
+
+// LABEL, LABEL:
+func (p *Parser) parseLabelDefinition() ast.Statement {
+	label := &ast.Label{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COLON) && p.onSameLine() {
+		p.nextToken()
+	}
+
+	// A keyword in the wrong case, with its operands, in strict mode
+	if p.miscased(label.Token, "") {
+		p.skipLine()
+		return nil
+	}
+
+	if p.onSameLine() && !p.peekTokenIs(token.EOF) && p.peekToken.Type == token.IDENT {
+		if !p.miscased(p.peekToken, "") {
+			p.errorf(p.peekToken.Pos, "unexpected identifier %q after label %q", p.peekToken.Literal, label.Value)
+		}
+		p.skipLine()
+	}
+
+	return label
+}
+
+func (p *Parser) parseInstruction() ast.Statement {
+	opcode := newOpcode(p.curToken)
+
+	switch name := opcode.Literal; {
+	case name == "ADD" || name == "AND":
+		return p.parseArithmetic(opcode)
+	case name == "NOT":
+		return p.parseTwoRegister(opcode)
+	case name == "LD" || name == "LDI" || name == "LEA" || name == "ST" || name == "STI":
+		return p.parseRegisterLabel(opcode)
+	case name == "LDR" || name == "STR":
+		return p.parseTwoRegisterOffset(opcode)
+	case name == "JMP" || name == "JSRR":
+		return p.parseOneRegister(opcode)
+	case name == "JSR":
+		return p.parseSubroutine(opcode)
+	case name == "RET" || name == "RTI":
+		return &ast.NoOperand{Token: p.curToken, Opcode: opcode}
+	case strings.HasPrefix(name, "BR"):
+		return p.parseBranch(opcode)
+	default:
+		p.errorf(p.curToken.Pos, "unknown opcode %q", name)
+		return nil
+	}
+}
+
+// ADD R1,R2,R3 or ADD R1,R2,#3
+func (p *Parser) parseArithmetic(opcode *ast.Opcode) ast.Statement {
+	tok := p.curToken
+
+	dr := p.parseRegister()
+	if dr == nil || !p.expectPeek(token.COMMA) {
+		return nil
+	}
+
+	sr1 := p.parseRegister()
+	if sr1 == nil || !p.expectPeek(token.COMMA) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.REGISTER) {
+		sr2 := p.parseRegister()
+		return &ast.ThreeRegisterStatement{
+			Token:           tok,
+			Opcode:          opcode,
+			DataRegister:    dr,
+			SourceRegisters: [2]*ast.Register{sr1, sr2},
+		}
+	}
+
+	imm := p.parseIntegerLiteral()
+	if imm == nil {
+		return nil
+	}
+
+	return &ast.TwoRegisterImmediate{
+		Token:          tok,
+		Opcode:         opcode,
+		DataRegister:   dr,
+		SourceRegister: sr1,
+		Immediate:      imm,
+	}
+}
+
+// NOT R1,R2
+func (p *Parser) parseTwoRegister(opcode *ast.Opcode) ast.Statement {
+	stmt := &ast.TwoRegister{Token: p.curToken, Opcode: opcode}
+
+	if stmt.DataRegister = p.parseRegister(); stmt.DataRegister == nil {
+		return nil
+	}
+	if !p.expectPeek(token.COMMA) {
+		return nil
+	}
+	if stmt.SourceRegister = p.parseRegister(); stmt.SourceRegister == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// LD R1,LABEL or LD R1,#-3
+func (p *Parser) parseRegisterLabel(opcode *ast.Opcode) ast.Statement {
+	stmt := &ast.RegisterLabelStatement{Token: p.curToken, Opcode: opcode}
+
+	if stmt.Register = p.parseRegister(); stmt.Register == nil {
+		return nil
+	}
+	if !p.expectPeek(token.COMMA) {
+		return nil
+	}
+
+	stmt.Label, stmt.Offset = p.parseTarget()
+	if stmt.Label == nil && stmt.Offset == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// LDR R1,R2,#4
+func (p *Parser) parseTwoRegisterOffset(opcode *ast.Opcode) ast.Statement {
+	stmt := &ast.TwoRegisterOffset{Token: p.curToken, Opcode: opcode}
+
+	if stmt.LeftRegister = p.parseRegister(); stmt.LeftRegister == nil {
+		return nil
+	}
+	if !p.expectPeek(token.COMMA) {
+		return nil
+	}
+	if stmt.RightRegister = p.parseRegister(); stmt.RightRegister == nil {
+		return nil
+	}
+	if !p.expectPeek(token.COMMA) {
+		return nil
+	}
+	if stmt.Offset = p.parseIntegerLiteral(); stmt.Offset == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// JMP R1
+func (p *Parser) parseOneRegister(opcode *ast.Opcode) ast.Statement {
+	stmt := &ast.OneRegister{Token: p.curToken, Opcode: opcode}
+
+	if stmt.Register = p.parseRegister(); stmt.Register == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// JSR LABEL
+func (p *Parser) parseSubroutine(opcode *ast.Opcode) ast.Statement {
+	stmt := &ast.SubroutineStatement{Token: p.curToken, Opcode: opcode}
+
+	stmt.Label, stmt.Offset = p.parseTarget()
+	if stmt.Label == nil && stmt.Offset == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// BRnzp LABEL
+func (p *Parser) parseBranch(opcode *ast.Opcode) ast.Statement {
+	stmt := &ast.BranchStatement{Token: p.curToken, Opcode: opcode}
+
+	for _, ch := range opcode.Literal[len("BR"):] {
+		switch ch {
+		case 'n':
+			stmt.N = true
+		case 'z':
+			stmt.Z = true
+		case 'p':
+			stmt.P = true
+		}
+	}
+
+	stmt.Label, stmt.Offset = p.parseTarget()
+	if stmt.Label == nil && stmt.Offset == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// TRAP x25 or one of the aliases such as HALT
+func (p *Parser) parseTrapStatement() ast.Statement {
+	stmt := &ast.TrapStatement{Token: p.curToken, Opcode: newOpcode(p.curToken)}
+
+	if vector, ok := token.TrapVectors[stmt.Opcode.Literal]; ok {
+		stmt.Vector = &ast.IntegerLiteral{Token: p.curToken, Value: vector}
+		return stmt
+	}
+
+	if stmt.Vector = p.parseIntegerLiteral(); stmt.Vector == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// .ORIG x3000, .FILL LABEL, .BLKW 5, .STRINGZ "Hi", .END, .BEGIN
+func (p *Parser) parseDirective() ast.Statement {
+	period := p.curToken
+	word := p.peekToken
+	word.Pos = period.Pos
+	if p.miscased(word, ".") || !p.expectPeek(token.DIRECTIVE) {
+		return nil
+	}
+
+	// The directive token spans the leading period as well
+	tok := p.curToken
+	tok.Pos = period.Pos
+
+	name, _ := token.Canonical(tok.Literal)
+	switch name {
+	case "ORIG":
+		stmt := &ast.OrigDirective{Token: tok}
+		if stmt.Address = p.parseIntegerLiteral(); stmt.Address == nil {
+			return nil
+		}
+		return stmt
+	case "FILL":
+		stmt := &ast.FillDirective{Token: tok}
+		stmt.Label, stmt.Value = p.parseTarget()
+		if stmt.Label == nil && stmt.Value == nil {
+			return nil
+		}
+		return stmt
+	case "BLKW":
+		stmt := &ast.BlkwDirective{Token: tok}
+		if stmt.Count = p.parseIntegerLiteral(); stmt.Count == nil {
+			return nil
+		}
+		return stmt
+	case "STRINGZ":
+		stmt := &ast.StringzDirective{Token: tok}
+		if p.peekTokenIs(token.ILLEGAL) {
+			p.nextToken()
+			p.illegal(p.curToken)
+			return nil
+		}
+		if !p.expectPeek(token.STRING) {
+			return nil
+		}
+		stmt.Value = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Str}
+		return stmt
+	case "END":
+		return &ast.EndDirective{Token: tok}
+	case "BEGIN":
+		return &ast.BeginDirective{Token: tok}
+	default:
+		p.errorf(tok.Pos, "unknown directive %q", tok.Literal)
+		return nil
+	}
+}
+
+// newOpcode returns the opcode of tok, spelled canonically whatever the
+// case it was written in.
+func newOpcode(tok token.Token) *ast.Opcode {
+	name, ok := token.Canonical(tok.Literal)
+	if !ok {
+		name = tok.Literal
+	}
+	return &ast.Opcode{Token: tok, Literal: name}
+}
+
+// miscased reports a keyword that the strict lexer took for an identifier
+// because of its case. The message shows the keyword after prefix, the
+// period of a directive.
+func (p *Parser) miscased(tok token.Token, prefix string) bool {
+	if tok.Type != token.IDENT {
+		return false
+	}
+	name, ok := token.Canonical(tok.Literal)
+	if !ok {
+		return false
+	}
+	p.errorf(tok.Pos, "%q must be written %q", prefix+tok.Literal, prefix+name)
+	return true
+}
+
+func (p *Parser) parseRegister() *ast.Register {
+	if p.miscased(p.peekToken, "") || !p.expectPeek(token.REGISTER) {
+		return nil
+	}
+
+	return &ast.Register{Token: p.curToken, ID: int(p.curToken.Literal[1] - '0')}
+}
+
+// parseTarget parses the operand of a PC-relative instruction, which is
+// either a label or a literal offset.
+func (p *Parser) parseTarget() (*ast.Label, *ast.IntegerLiteral) {
+	if p.miscased(p.peekToken, "") {
+		p.nextToken()
+		return nil, nil
+	}
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		return &ast.Label{Token: p.curToken, Value: p.curToken.Literal}, nil
+	}
+
+	return nil, p.parseIntegerLiteral()
+}
+
+// parseIntegerLiteral parses the next operand as a number: #10, #-1, 10,
+// x1F, b101, or a character's code: 'A', #'A'.
+func (p *Parser) parseIntegerLiteral() *ast.IntegerLiteral {
+	var start token.Position
+	if p.peekTokenIs(token.HASH) {
+		p.nextToken()
+		start = p.curToken.Pos
+	}
+
+	switch {
+	case p.peekTokenIs(token.ILLEGAL):
+		p.nextToken()
+		p.illegal(p.curToken)
+		return nil
+	case start.IsValid() && !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.CHAR):
+		p.peekError(token.INT)
+		return nil
+	case p.peekTokenIs(token.INT) || p.peekTokenIs(token.HEX) || p.peekTokenIs(token.BIN) || p.peekTokenIs(token.CHAR):
+		p.nextToken()
+	default:
+		p.errorf(p.peekToken.Pos, "expected number, got %s %q instead", p.peekToken.Type, p.peekToken.Literal)
+		return nil
+	}
+
+	// The literal spans the leading '#' as well
+	lit := &ast.IntegerLiteral{Token: p.curToken, Value: p.curToken.Value}
+	if start.IsValid() {
+		lit.Token.Pos = start
+	}
+	return lit
+}
+
+// illegal reports an ILLEGAL token, with the lexer's reason if it gave one.
+func (p *Parser) illegal(tok token.Token) {
+	if tok.Reason != "" {
+		p.errorf(tok.Pos, "illegal token %q: %s", tok.Literal, tok.Reason)
+		return
+	}
+	p.errorf(tok.Pos, "illegal token %q", tok.Literal)
+}
+
+// expectEndOfLine reports anything left on the line after a complete
+// statement.
+func (p *Parser) expectEndOfLine() {
+	if p.onSameLine() && !p.peekTokenIs(token.EOF) {
+		p.errorf(p.peekToken.Pos, "unexpected %s %q after statement", p.peekToken.Type, p.peekToken.Literal)
+		p.skipLine()
+	}
+}
+
+// skipLine advances to the last token on the current line, so that parsing
+// resumes with the next line after an error.
+func (p *Parser) skipLine() {
+	for p.onSameLine() && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+	}
+}
+
+func (p *Parser) onSameLine() bool {
+	return p.peekToken.Pos.Line == p.curToken.Pos.Line
+}
+
+func (p *Parser) peekTokenIs(t token.TokenType) bool {
+	return p.peekToken.Type == t
+}
+
+func (p *Parser) expectPeek(t token.TokenType) bool {
+	if p.peekTokenIs(t) {
+		p.nextToken()
+		return true
+	} else {
+		p.peekError(t)
+		return false
+	}
+}
+
+func (p *Parser) peekError(t token.TokenType) {
+	p.errorf(p.peekToken.Pos, "expected next token to be %s, got %s %q instead", t, p.peekToken.Type, p.peekToken.Literal)
+}
+
+func (p *Parser) errorf(pos token.Position, format string, args ...interface{}) {
+	p.errors = append(p.errors, Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,585 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+
+	"lc3asm-parser/ast"
+	"lc3asm-parser/lexer"
+)
+
+func TestArithmeticStatements(t *testing.T) {
+	input := `ADD R1,R2,R3
+AND R4, R5, #-3
+ADD R0,R0,x1
+NOT R6,R7`
+
+	program := parse(t, input)
+	checkStatementCount(t, program, 4)
+
+	trs, ok := program.Statements[0].(*ast.ThreeRegisterStatement)
+	if !ok {
+		t.Fatalf("stmt[0] not *ast.ThreeRegisterStatement. got=%T", program.Statements[0])
+	}
+	if trs.Opcode.Literal != "ADD" || trs.DataRegister.ID != 1 ||
+		trs.SourceRegisters[0].ID != 2 || trs.SourceRegisters[1].ID != 3 {
+		t.Errorf("stmt[0] wrong. got=%+v", trs)
+	}
+
+	tests := []struct {
+		opcode    string
+		dr        int
+		sr        int
+		immediate int
+	}{
+		{"AND", 4, 5, -3},
+		{"ADD", 0, 0, 1},
+	}
+
+	for i, tt := range tests {
+		tri, ok := program.Statements[i+1].(*ast.TwoRegisterImmediate)
+		if !ok {
+			t.Fatalf("tests[%d] - not *ast.TwoRegisterImmediate. got=%T", i, program.Statements[i+1])
+		}
+		if tri.Opcode.Literal != tt.opcode {
+			t.Errorf("tests[%d] - opcode wrong. expected=%q, got=%q", i, tt.opcode, tri.Opcode.Literal)
+		}
+		if tri.DataRegister.ID != tt.dr || tri.SourceRegister.ID != tt.sr {
+			t.Errorf("tests[%d] - registers wrong. expected=R%d,R%d, got=R%d,R%d",
+				i, tt.dr, tt.sr, tri.DataRegister.ID, tri.SourceRegister.ID)
+		}
+		if tri.Immediate.Value != tt.immediate {
+			t.Errorf("tests[%d] - immediate wrong. expected=%d, got=%d", i, tt.immediate, tri.Immediate.Value)
+		}
+	}
+
+	tr, ok := program.Statements[3].(*ast.TwoRegister)
+	if !ok {
+		t.Fatalf("stmt[3] not *ast.TwoRegister. got=%T", program.Statements[3])
+	}
+	if tr.DataRegister.ID != 6 || tr.SourceRegister.ID != 7 {
+		t.Errorf("stmt[3] registers wrong. got=R%d,R%d", tr.DataRegister.ID, tr.SourceRegister.ID)
+	}
+}
+
+func TestMemoryStatements(t *testing.T) {
+	input := `LD R1,DATA
+LDI R2,#-4
+LEA R3,DATA
+ST R4,DATA
+STI R5,DATA
+LDR R6,R5,#-1
+STR R0,R6,#2`
+
+	program := parse(t, input)
+	checkStatementCount(t, program, 7)
+
+	tests := []struct {
+		opcode   string
+		register int
+		label    string
+		offset   int
+	}{
+		{"LD", 1, "DATA", 0},
+		{"LDI", 2, "", -4},
+		{"LEA", 3, "DATA", 0},
+		{"ST", 4, "DATA", 0},
+		{"STI", 5, "DATA", 0},
+	}
+
+	for i, tt := range tests {
+		rls, ok := program.Statements[i].(*ast.RegisterLabelStatement)
+		if !ok {
+			t.Fatalf("tests[%d] - not *ast.RegisterLabelStatement. got=%T", i, program.Statements[i])
+		}
+		if rls.Opcode.Literal != tt.opcode {
+			t.Errorf("tests[%d] - opcode wrong. expected=%q, got=%q", i, tt.opcode, rls.Opcode.Literal)
+		}
+		if rls.Register.ID != tt.register {
+			t.Errorf("tests[%d] - register wrong. expected=%d, got=%d", i, tt.register, rls.Register.ID)
+		}
+		if tt.label != "" {
+			if rls.Label == nil || rls.Label.Value != tt.label {
+				t.Errorf("tests[%d] - label wrong. expected=%q, got=%+v", i, tt.label, rls.Label)
+			}
+		} else if rls.Offset == nil || rls.Offset.Value != tt.offset {
+			t.Errorf("tests[%d] - offset wrong. expected=%d, got=%+v", i, tt.offset, rls.Offset)
+		}
+	}
+
+	offsetTests := []struct {
+		opcode string
+		left   int
+		right  int
+		offset int
+	}{
+		{"LDR", 6, 5, -1},
+		{"STR", 0, 6, 2},
+	}
+
+	for i, tt := range offsetTests {
+		tro, ok := program.Statements[i+5].(*ast.TwoRegisterOffset)
+		if !ok {
+			t.Fatalf("offsetTests[%d] - not *ast.TwoRegisterOffset. got=%T", i, program.Statements[i+5])
+		}
+		if tro.Opcode.Literal != tt.opcode || tro.LeftRegister.ID != tt.left ||
+			tro.RightRegister.ID != tt.right || tro.Offset.Value != tt.offset {
+			t.Errorf("offsetTests[%d] - wrong. expected=%+v, got=%s R%d,R%d,%d", i, tt,
+				tro.Opcode.Literal, tro.LeftRegister.ID, tro.RightRegister.ID, tro.Offset.Value)
+		}
+	}
+}
+
+func TestControlStatements(t *testing.T) {
+	input := `BR LOOP
+BRnz LOOP
+BRzp #-2
+JMP R2
+JSRR R3
+JSR SUB
+RET
+RTI`
+
+	program := parse(t, input)
+	checkStatementCount(t, program, 8)
+
+	branchTests := []struct {
+		n, z, p bool
+		label   string
+	}{
+		{false, false, false, "LOOP"},
+		{true, true, false, "LOOP"},
+		{false, true, true, ""},
+	}
+
+	for i, tt := range branchTests {
+		bs, ok := program.Statements[i].(*ast.BranchStatement)
+		if !ok {
+			t.Fatalf("branchTests[%d] - not *ast.BranchStatement. got=%T", i, program.Statements[i])
+		}
+		if bs.N != tt.n || bs.Z != tt.z || bs.P != tt.p {
+			t.Errorf("branchTests[%d] - flags wrong. expected=%v%v%v, got=%v%v%v",
+				i, tt.n, tt.z, tt.p, bs.N, bs.Z, bs.P)
+		}
+		if tt.label == "" && (bs.Label != nil || bs.Offset.Value != -2) {
+			t.Errorf("branchTests[%d] - expected offset #-2, got=%+v", i, bs)
+		}
+		if tt.label != "" && (bs.Label == nil || bs.Label.Value != tt.label) {
+			t.Errorf("branchTests[%d] - label wrong. expected=%q, got=%+v", i, tt.label, bs.Label)
+		}
+	}
+
+	for i, id := range []int{2, 3} {
+		or, ok := program.Statements[i+3].(*ast.OneRegister)
+		if !ok {
+			t.Fatalf("stmt[%d] not *ast.OneRegister. got=%T", i+3, program.Statements[i+3])
+		}
+		if or.Register.ID != id {
+			t.Errorf("stmt[%d] register wrong. expected=%d, got=%d", i+3, id, or.Register.ID)
+		}
+	}
+
+	ss, ok := program.Statements[5].(*ast.SubroutineStatement)
+	if !ok {
+		t.Fatalf("stmt[5] not *ast.SubroutineStatement. got=%T", program.Statements[5])
+	}
+	if ss.Label == nil || ss.Label.Value != "SUB" {
+		t.Errorf("stmt[5] label wrong. got=%+v", ss.Label)
+	}
+
+	for _, i := range []int{6, 7} {
+		if _, ok := program.Statements[i].(*ast.NoOperand); !ok {
+			t.Errorf("stmt[%d] not *ast.NoOperand. got=%T", i, program.Statements[i])
+		}
+	}
+}
+
+func TestTrapStatements(t *testing.T) {
+	input := `TRAP x25
+GETC
+OUT
+PUTS
+IN
+PUTSP
+HALT`
+
+	program := parse(t, input)
+	checkStatementCount(t, program, 7)
+
+	tests := []struct {
+		opcode string
+		vector int
+	}{
+		{"TRAP", 0x25},
+		{"GETC", 0x20},
+		{"OUT", 0x21},
+		{"PUTS", 0x22},
+		{"IN", 0x23},
+		{"PUTSP", 0x24},
+		{"HALT", 0x25},
+	}
+
+	for i, tt := range tests {
+		ts, ok := program.Statements[i].(*ast.TrapStatement)
+		if !ok {
+			t.Fatalf("tests[%d] - not *ast.TrapStatement. got=%T", i, program.Statements[i])
+		}
+		if ts.Opcode.Literal != tt.opcode {
+			t.Errorf("tests[%d] - opcode wrong. expected=%q, got=%q", i, tt.opcode, ts.Opcode.Literal)
+		}
+		if ts.Vector.Value != tt.vector {
+			t.Errorf("tests[%d] - vector wrong. expected=x%X, got=x%X", i, tt.vector, ts.Vector.Value)
+		}
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	input := `.ORIG x3000
+.FILL #-1
+.FILL DATA
+.BLKW 4
+.STRINGZ "Hello, World"
+.BEGIN
+.END`
+
+	program := parse(t, input)
+	checkStatementCount(t, program, 7)
+
+	orig, ok := program.Statements[0].(*ast.OrigDirective)
+	if !ok || orig.Address.Value != 0x3000 {
+		t.Errorf("stmt[0] not .ORIG x3000. got=%+v", program.Statements[0])
+	}
+	if ok && orig.Token.Pos.Column != 1 {
+		t.Errorf("stmt[0] should start at the period. got column %d", orig.Token.Pos.Column)
+	}
+
+	fill, ok := program.Statements[1].(*ast.FillDirective)
+	if !ok || fill.Value == nil || fill.Value.Value != -1 {
+		t.Errorf("stmt[1] not .FILL #-1. got=%+v", program.Statements[1])
+	}
+
+	fill, ok = program.Statements[2].(*ast.FillDirective)
+	if !ok || fill.Label == nil || fill.Label.Value != "DATA" {
+		t.Errorf("stmt[2] not .FILL DATA. got=%+v", program.Statements[2])
+	}
+
+	blkw, ok := program.Statements[3].(*ast.BlkwDirective)
+	if !ok || blkw.Count.Value != 4 {
+		t.Errorf("stmt[3] not .BLKW 4. got=%+v", program.Statements[3])
+	}
+
+	str, ok := program.Statements[4].(*ast.StringzDirective)
+	if !ok || str.Value.Value != "Hello, World" {
+		t.Errorf("stmt[4] not .STRINGZ. got=%+v", program.Statements[4])
+	}
+
+	if _, ok := program.Statements[5].(*ast.BeginDirective); !ok {
+		t.Errorf("stmt[5] not *ast.BeginDirective. got=%T", program.Statements[5])
+	}
+
+	if _, ok := program.Statements[6].(*ast.EndDirective); !ok {
+		t.Errorf("stmt[6] not *ast.EndDirective. got=%T", program.Statements[6])
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{".FILL xFE00", 0xFE00},
+		{".FILL xfe02", 0xFE02},
+		{".FILL X7FFF", 0x7FFF},
+		{".FILL x-1", -1},
+		{".FILL 0x1F", 0x1F},
+		{".FILL b1011", 11},
+		{".FILL 0b101", 5},
+		{".FILL 12", 12},
+		{".FILL -12", -12},
+		{".FILL #-512", -512},
+	}
+
+	for i, tt := range tests {
+		program := parse(t, tt.input)
+		checkStatementCount(t, program, 1)
+
+		fill, ok := program.Statements[0].(*ast.FillDirective)
+		if !ok || fill.Value == nil || fill.Value.Value != tt.expected {
+			t.Errorf("tests[%d] - value wrong. expected=%d, got=%+v", i, tt.expected, program.Statements[0])
+		}
+	}
+}
+
+func TestLabelDefinitions(t *testing.T) {
+	input := `START: ADD R1,R1,#1 ; comment
+LOOP
+	BRp LOOP
+DONE HALT
+DATA .FILL #0`
+
+	program := parse(t, input)
+
+	expected := []string{"*ast.Label", "*ast.TwoRegisterImmediate", "*ast.Label", "*ast.BranchStatement",
+		"*ast.Label", "*ast.TrapStatement", "*ast.Label", "*ast.FillDirective"}
+	checkStatementCount(t, program, len(expected))
+
+	for i, typ := range expected {
+		if got := fmt.Sprintf("%T", program.Statements[i]); got != typ {
+			t.Errorf("stmt[%d] type wrong. expected=%s, got=%s", i, typ, got)
+		}
+	}
+
+	labels := []string{"START", "LOOP", "DONE", "DATA"}
+	for i, name := range labels {
+		label, ok := program.Statements[i*2].(*ast.Label)
+		if !ok {
+			t.Fatalf("stmt[%d] not *ast.Label. got=%T", i*2, program.Statements[i*2])
+		}
+		if label.Value != name {
+			t.Errorf("stmt[%d] label wrong. expected=%q, got=%q", i*2, name, label.Value)
+		}
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	input := `ADD R1,R2
+NOT R1,R2
+LD R1 DATA
+AND R1,R2,R3 R4
+.ORIG LABEL
+@
+ADD R1,R1,#12a
+.FILL 0x1G
+.STRINGZ "open
+HALT`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"2:1: expected next token to be ,, got OPCODE \"NOT\" instead",
+		"3:7: expected next token to be ,, got IDENT \"DATA\" instead",
+		"4:14: unexpected REGISTER \"R4\" after statement",
+		"5:7: expected number, got IDENT \"LABEL\" instead",
+		"6:1: illegal token \"@\"",
+		"7:12: illegal token \"12a\": invalid digit 'a' in decimal number",
+		"8:7: illegal token \"0x1G\": invalid digit 'G' in hexadecimal number",
+		"9:10: illegal token \"\\\"open\": string not terminated",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d: %v", len(expected), len(errors), errors)
+	}
+
+	for i, msg := range expected {
+		if errors[i].Error() != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i].Error())
+		}
+	}
+
+	// Parsing recovers at the next line after each error
+	checkStatementCount(t, program, 3)
+	if _, ok := program.Statements[2].(*ast.TrapStatement); !ok {
+		t.Errorf("last statement not *ast.TrapStatement. got=%T", program.Statements[2])
+	}
+}
+
+func TestKeywordCase(t *testing.T) {
+	input := `.orig x3000
+loop add r1, R2, #3
+brNZ loop
+Halt
+trap x25
+.End`
+
+	program := parse(t, input)
+	checkStatementCount(t, program, 7)
+
+	if _, ok := program.Statements[0].(*ast.OrigDirective); !ok {
+		t.Errorf("statement 0 not *ast.OrigDirective. got=%T", program.Statements[0])
+	}
+
+	add, ok := program.Statements[2].(*ast.TwoRegisterImmediate)
+	if !ok {
+		t.Fatalf("statement 2 not *ast.TwoRegisterImmediate. got=%T", program.Statements[2])
+	}
+	if add.Opcode.Literal != "ADD" || add.Opcode.TokenLiteral() != "add" {
+		t.Errorf("opcode wrong. expected=ADD written add, got=%s written %s", add.Opcode.Literal, add.Opcode.TokenLiteral())
+	}
+	if add.DataRegister.ID != 1 || add.SourceRegister.ID != 2 {
+		t.Errorf("registers wrong. got=%d %d", add.DataRegister.ID, add.SourceRegister.ID)
+	}
+
+	br, ok := program.Statements[3].(*ast.BranchStatement)
+	if !ok {
+		t.Fatalf("statement 3 not *ast.BranchStatement. got=%T", program.Statements[3])
+	}
+	if br.Opcode.Literal != "BRnz" || !br.N || !br.Z || br.P {
+		t.Errorf("branch wrong. got=%s n=%t z=%t p=%t", br.Opcode.Literal, br.N, br.Z, br.P)
+	}
+
+	for i, opcode := range []string{"HALT", "TRAP"} {
+		ts, ok := program.Statements[4+i].(*ast.TrapStatement)
+		if !ok {
+			t.Fatalf("statement %d not *ast.TrapStatement. got=%T", 4+i, program.Statements[4+i])
+		}
+		if ts.Opcode.Literal != opcode || ts.Vector.Value != 0x25 {
+			t.Errorf("trap %d wrong. got=%s x%X", i, ts.Opcode.Literal, ts.Vector.Value)
+		}
+	}
+
+	if _, ok := program.Statements[6].(*ast.EndDirective); !ok {
+		t.Errorf("statement 6 not *ast.EndDirective. got=%T", program.Statements[6])
+	}
+}
+
+func TestStrictKeywordCase(t *testing.T) {
+	input := `add R1,R2,#3
+ADD r1,R2,#3
+.orig x3000
+.fill #0
+halt
+	ret
+L brNZ L
+LD R1, out
+.FILL halt
+HALT`
+
+	p := New(lexer.NewStrict(input))
+	program := p.ParseProgram()
+
+	expected := []string{
+		`1:1: "add" must be written "ADD"`,
+		`2:5: "r1" must be written "R1"`,
+		`3:1: ".orig" must be written ".ORIG"`,
+		`4:1: ".fill" must be written ".FILL"`,
+		`5:1: "halt" must be written "HALT"`,
+		`6:2: "ret" must be written "RET"`,
+		`7:3: "brNZ" must be written "BRnz"`,
+		`8:8: "out" must be written "OUT"`,
+		`9:7: "halt" must be written "HALT"`,
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d: %v", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i].Error() != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i].Error())
+		}
+	}
+
+	// Only the label and the correctly cased HALT are left
+	checkStatementCount(t, program, 2)
+}
+
+func TestComments(t *testing.T) {
+	input := `; header
+LOOP ADD R1,R1,#-1 ; count down
+	;
+	BRp LOOP`
+
+	program := parse(t, input)
+	checkStatementCount(t, program, 3)
+
+	tests := []struct {
+		line int
+		text string
+	}{
+		{1, "; header"},
+		{2, "; count down"},
+		{3, ";"},
+	}
+
+	if len(program.Comments) != len(tests) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(tests), len(program.Comments))
+	}
+	for i, tt := range tests {
+		c := program.Comments[i]
+		if c.Pos().Line != tt.line || c.Text != tt.text {
+			t.Errorf("tests[%d] - comment wrong. expected=%d %q, got=%d %q", i, tt.line, tt.text, c.Pos().Line, c.Text)
+		}
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	input := `; header
+
+; about LOOP
+LOOP ADD R1,R1,#-1 ; count down
+
+
+	BRp LOOP
+	HALT
+	; done
+
+; end`
+
+	program := parse(t, input)
+	checkStatementCount(t, program, 4)
+
+	label := program.TriviaOf(program.Statements[0])
+	if len(label.Leading) != 2 || label.Leading[0].Text != "; header" || label.Leading[1].Text != "; about LOOP" {
+		t.Fatalf("label leading comments wrong. got=%v", label.Leading)
+	}
+	if label.Leading[0].BlankBefore || !label.Leading[1].BlankBefore || label.BlankBefore || label.Trailing != nil {
+		t.Errorf("label trivia wrong. got=%+v", label)
+	}
+
+	add := program.TriviaOf(program.Statements[1])
+	if len(add.Leading) != 0 || add.Trailing == nil || add.Trailing.Text != "; count down" {
+		t.Errorf("ADD trivia wrong. got=%+v", add)
+	}
+
+	br := program.TriviaOf(program.Statements[2])
+	if !br.BlankBefore || len(br.Leading) != 0 || br.Trailing != nil {
+		t.Errorf("BRp trivia wrong. got=%+v", br)
+	}
+
+	halt := program.TriviaOf(program.Statements[3])
+	if halt.BlankBefore || len(halt.Leading) != 0 || halt.Trailing != nil {
+		t.Errorf("HALT trivia wrong. got=%+v", halt)
+	}
+
+	end := program.EndComments
+	if len(end) != 2 || end[0].Text != "; done" || end[0].BlankBefore || !end[1].BlankBefore {
+		t.Errorf("end comments wrong. got=%v", end)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return program
+}
+
+func checkParserErrors(t *testing.T, p *Parser) {
+	t.Helper()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		return
+	}
+
+	t.Errorf("parser has %d errors", len(errors))
+	for _, err := range errors {
+		t.Errorf("parser error: %s", err)
+	}
+	t.FailNow()
+}
+
+func checkStatementCount(t *testing.T, program *ast.Program, count int) {
+	t.Helper()
+
+	if len(program.Statements) != count {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d", count, len(program.Statements))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/disasm"
+	"lc3asm-parser/lc3os"
+	"lc3asm-parser/trace"
+	"lc3asm-parser/vm"
+)
+
+// runProgram implements `run [-trace file] file.asm|file.obj`.
+func runProgram(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	tracePath := fs.String("trace", "", "write a record of every executed instruction to this file")
+	traceFormat := fs.String("trace-format", "", "trace format, jsonl or csv (default: from the file extension)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: run [-trace file] [-trace-format jsonl|csv] file.asm|file.obj")
+	}
+
+	m, obj, err := loadProgram(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *tracePath != "" {
+		if *traceFormat == "" {
+			*traceFormat = "jsonl"
+			if filepath.Ext(*tracePath) == ".csv" {
+				*traceFormat = "csv"
+			}
+		}
+		format, err := trace.ParseFormat(*traceFormat)
+		if err != nil {
+			return err
+		}
+
+		tables := []*assembler.SymbolTable{lc3os.Image().Symbols}
+		if obj != nil {
+			tables = append([]*assembler.SymbolTable{obj.Symbols}, tables...)
+		}
+
+		return writeFile(*tracePath, func(w io.Writer) error {
+			tw := trace.NewWriter(w, format, disasm.SymbolLabels(tables...))
+			m.OnTrace = tw.Trace
+			err := execute(m)
+			if ferr := tw.Flush(); err == nil {
+				err = ferr
+			}
+			return err
+		})
+	}
+
+	return execute(m)
+}
+
+// execute runs m with the terminal as its console.
+func execute(m *vm.Machine) error {
+	// Read the terminal in the background so that interrupt-driven
+	// programs keep running while they wait for a key
+	m.AttachKeyboardConsole(vm.NewAsyncKeyboard(os.Stdin), os.Stdout)
+	return m.Run()
+}
+
+// loadProgram loads an object file into a new machine. Assembly sources
+// are assembled first, and the object is returned with the machine.
+func loadProgram(path string) (*vm.Machine, *assembler.Object, error) {
+	m := vm.New()
+
+	if filepath.Ext(path) == ".asm" {
+		obj, err := assembleFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		m.LoadImage(obj.Origin, obj.Code)
+		m.PC = obj.Origin
+		return m, obj, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	return m, nil, m.Load(f)
+}
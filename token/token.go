@@ -1,10 +1,43 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type TokenType string
 
+// Token is a lexeme of the source. Literal is its text exactly as written,
+// from Pos to End, so a string or character keeps its quotes and an
+// unterminated one runs to the end of the line; their decoded values are
+// in Str and Value.
 type Token struct {
 	Type    TokenType
 	Literal string
+	Value   int      // Value of an INT, HEX or BIN number, or a CHAR's code
+	Str     string   // Value of a STRING, with escapes decoded
+	Reason  string   // Why an ILLEGAL token is malformed, if known
+	Pos     Position // Position of the first character of the token
+	End     Position // Position immediately after the last character
+}
+
+// Position is a location in the source. Line and Column are 1-based,
+// Offset is the 0-based byte offset into the input.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position has been set.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -29,8 +62,12 @@ const (
 	COMMENT   = "COMMENT"
 
 	// Number Types
-	INT = "INT"
-	HEX = "HEX"
+	INT = "INT" // 12, -12
+	HEX = "HEX" // x1F, X1f, x-1, 0x1F
+	BIN = "BIN" // b101, 0b101
+
+	STRING = "STRING"
+	CHAR   = "CHAR" // 'A', '\n'
 
 	// Indentation
 	INDENT = "INDENT"
@@ -102,7 +139,62 @@ var keywords = map[string]TokenType{
 	"BRpnz": OPCODE,
 }
 
+// TrapVectors maps the trap aliases to the vector they stand for.
+var TrapVectors = map[string]int{
+	"GETC":  0x20,
+	"OUT":   0x21,
+	"PUTS":  0x22,
+	"IN":    0x23,
+	"PUTSP": 0x24,
+	"HALT":  0x25,
+}
+
+// Keyword is a reserved word: an opcode, directive, trap or register.
+type Keyword struct {
+	Word string
+	Type TokenType
+}
+
+// Keywords returns the reserved words with their types, sorted by word.
+func Keywords() []Keyword {
+	kws := make([]Keyword, 0, len(keywords))
+	for word, t := range keywords {
+		kws = append(kws, Keyword{Word: word, Type: t})
+	}
+	sort.Slice(kws, func(i, j int) bool { return kws[i].Word < kws[j].Word })
+	return kws
+}
+
+// folded maps the upper-case form of each keyword to the keyword.
+var folded = func() map[string]string {
+	m := make(map[string]string, len(keywords))
+	for word := range keywords {
+		m[strings.ToUpper(word)] = word
+	}
+	return m
+}()
+
+// Canonical returns the keyword ident stands for in any case, written as
+// in the keyword table: upper case, except for BR's condition codes. It
+// reports false if ident is not a keyword.
+func Canonical(ident string) (string, bool) {
+	word, ok := folded[strings.ToUpper(ident)]
+	return word, ok
+}
+
+// LookupIdent returns the type of ident, recognizing keywords in any case
+// as lc3as does: add, Add and ADD are all the opcode ADD.
 func LookupIdent(ident string) TokenType {
+	if word, ok := Canonical(ident); ok {
+		return keywords[word]
+	}
+
+	return IDENT
+}
+
+// LookupIdentStrict recognizes keywords only in their canonical case, for
+// sources held to a consistent style. Other spellings are identifiers.
+func LookupIdentStrict(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
 		return tok
 	}
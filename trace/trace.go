@@ -0,0 +1,156 @@
+// Package trace writes one record per executed instruction, in a form
+// that can be diffed between runs or read by other tools: the PC, the
+// instruction word and its disassembly, the registers it changed, the
+// memory it wrote and the condition codes it left.
+package trace
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"lc3asm-parser/disasm"
+	"lc3asm-parser/vm"
+)
+
+// Format selects the encoding of a trace.
+type Format int
+
+const (
+	JSONLines Format = iota
+	CSV
+)
+
+// ParseFormat returns the format called name: jsonl or csv.
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "jsonl", "json":
+		return JSONLines, nil
+	case "csv":
+		return CSV, nil
+	}
+	return 0, fmt.Errorf("unknown trace format %q", name)
+}
+
+// Record is one executed instruction. Addresses and values are written
+// as LC-3 hex literals such as x3000.
+type Record struct {
+	PC          string            `json:"pc"`
+	Word        string            `json:"word"`
+	Disassembly string            `json:"asm"`
+	Registers   map[string]string `json:"registers"` // Changed registers, R0-R7
+	Memory      []Write           `json:"memory"`    // Writes in the order made
+	CC          string            `json:"cc"`
+}
+
+type Write struct {
+	Address string `json:"address"`
+	Value   string `json:"value"`
+}
+
+// Writer encodes vm.Trace records as they arrive. Pass its Trace method
+// to vm.Machine.OnTrace and call Flush when the run ends.
+type Writer struct {
+	format Format
+	labels disasm.Labels
+	buf    *bufio.Writer
+	json   *json.Encoder
+	csv    *csv.Writer
+	err    error
+}
+
+// NewWriter returns a writer that encodes to w, naming branch and load
+// targets through labels, which may be nil.
+func NewWriter(w io.Writer, format Format, labels disasm.Labels) *Writer {
+	tw := &Writer{format: format, labels: labels, buf: bufio.NewWriter(w)}
+	if format == CSV {
+		tw.csv = csv.NewWriter(tw.buf)
+		tw.err = tw.csv.Write([]string{"pc", "word", "asm", "registers", "memory", "cc"})
+	} else {
+		tw.json = json.NewEncoder(tw.buf)
+	}
+	return tw
+}
+
+// Trace writes the record for t. After an error it does nothing; the
+// error is returned by Flush.
+func (tw *Writer) Trace(t vm.Trace) {
+	if tw.err != nil {
+		return
+	}
+
+	rec := NewRecord(t, tw.labels)
+	if tw.format == JSONLines {
+		tw.err = tw.json.Encode(rec)
+		return
+	}
+
+	var regs, mem []string
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("R%d", i)
+		if value, ok := rec.Registers[name]; ok {
+			regs = append(regs, name+"="+value)
+		}
+	}
+	for _, w := range rec.Memory {
+		mem = append(mem, w.Address+"="+w.Value)
+	}
+	tw.err = tw.csv.Write([]string{
+		rec.PC, rec.Word, rec.Disassembly, strings.Join(regs, " "), strings.Join(mem, " "), rec.CC,
+	})
+}
+
+// Flush writes any buffered records and returns the first error.
+func (tw *Writer) Flush() error {
+	if tw.csv != nil {
+		tw.csv.Flush()
+		if tw.err == nil {
+			tw.err = tw.csv.Error()
+		}
+	}
+	if err := tw.buf.Flush(); tw.err == nil {
+		tw.err = err
+	}
+	return tw.err
+}
+
+// NewRecord describes t, disassembling through labels.
+func NewRecord(t vm.Trace, labels disasm.Labels) Record {
+	rec := Record{
+		PC:          hex(t.PC),
+		Word:        hex(t.Instruction),
+		Disassembly: disasm.Disassemble(t.PC, t.Instruction, labels),
+		Registers:   make(map[string]string),
+		Memory:      []Write{},
+		CC:          cc(t.After.PSR),
+	}
+
+	for i, value := range t.After.Registers {
+		if value != t.Before.Registers[i] {
+			rec.Registers[fmt.Sprintf("R%d", i)] = hex(value)
+		}
+	}
+	for _, w := range t.Writes {
+		rec.Memory = append(rec.Memory, Write{hex(w.Address), hex(w.Value)})
+	}
+	return rec
+}
+
+func hex(value uint16) string {
+	return fmt.Sprintf("x%04X", value)
+}
+
+func cc(psr uint16) string {
+	switch psr & 7 {
+	case vm.FlagN:
+		return "N"
+	case vm.FlagZ:
+		return "Z"
+	case vm.FlagP:
+		return "P"
+	}
+	return "-"
+}
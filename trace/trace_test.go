@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/disasm"
+	"lc3asm-parser/vm"
+)
+
+const program = `.ORIG x3000
+	LD R1, VALUE
+	ADD R1, R1, #-2
+	ST R1, VALUE
+	HALT
+VALUE	.FILL #2
+.END`
+
+func TestJSONLines(t *testing.T) {
+	out := trace(t, JSONLines)
+	lines := strings.Split(out, "\n")
+
+	expected := []string{
+		`{"pc":"x3000","word":"x2203","asm":"LD R1, VALUE","registers":{"R1":"x0002"},"memory":[],"cc":"P"}`,
+		`{"pc":"x3001","word":"x127E","asm":"ADD R1, R1, #-2","registers":{"R1":"x0000"},"memory":[],"cc":"Z"}`,
+		`{"pc":"x3002","word":"x3201","asm":"ST R1, VALUE","registers":{},"memory":[{"address":"x3004","value":"x0000"}],"cc":"Z"}`,
+		`{"pc":"x3003","word":"xF025","asm":"HALT","registers":{"R7":"x3004"},"memory":[],"cc":"Z"}`,
+	}
+	for i, e := range expected {
+		if lines[i] != e {
+			t.Errorf("lines[%d] wrong.\nexpected=%s\ngot=     %s", i, e, lines[i])
+		}
+	}
+
+	// The trace continues into the operating system's HALT routine
+	if !strings.Contains(lines[4], `"pc":"`) || !strings.HasSuffix(out, "}\n") {
+		t.Errorf("trace of HALT routine missing")
+	}
+}
+
+func TestCSV(t *testing.T) {
+	lines := strings.Split(trace(t, CSV), "\n")
+
+	expected := []string{
+		"pc,word,asm,registers,memory,cc",
+		`x3000,x2203,"LD R1, VALUE",R1=x0002,,P`,
+		`x3001,x127E,"ADD R1, R1, #-2",R1=x0000,,Z`,
+		`x3002,x3201,"ST R1, VALUE",,x3004=x0000,Z`,
+		`x3003,xF025,HALT,R7=x3004,,Z`,
+	}
+	for i, e := range expected {
+		if lines[i] != e {
+			t.Errorf("lines[%d] wrong. expected=%q, got=%q", i, e, lines[i])
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat("csv"); err != nil || f != CSV {
+		t.Errorf("csv wrong. got=%d %v", f, err)
+	}
+	if f, err := ParseFormat("jsonl"); err != nil || f != JSONLines {
+		t.Errorf("jsonl wrong. got=%d %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("expected error for xml")
+	}
+}
+
+// trace runs program and returns its trace in format.
+func trace(t *testing.T, format Format) string {
+	t.Helper()
+
+	obj, err := assembler.Assemble(program)
+	if err != nil {
+		t.Fatalf("assembly failed:\n%s", err)
+	}
+
+	m := vm.New()
+	m.LoadImage(obj.Origin, obj.Code)
+	m.PC = obj.Origin
+	m.AttachConsole(nil, io.Discard)
+
+	var buf bytes.Buffer
+	tw := NewWriter(&buf, format, disasm.SymbolLabels(obj.Symbols))
+	m.OnTrace = tw.Trace
+	if err := m.Run(); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	if err := tw.Flush(); err != nil {
+		t.Fatalf("flush failed: %s", err)
+	}
+	return buf.String()
+}
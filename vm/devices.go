@@ -0,0 +1,224 @@
+package vm
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// Memory-mapped device registers
+const (
+	KBSR = 0xFE00 // Keyboard status
+	KBDR = 0xFE02 // Keyboard data
+	DSR  = 0xFE04 // Display status
+	DDR  = 0xFE06 // Display data
+	MCR  = 0xFFFE // Machine control
+)
+
+const (
+	statusReady     = 1 << 15
+	interruptEnable = 1 << 14
+	clockEnable     = 1 << 15
+)
+
+// ErrNoInput is raised when a program waits on a keyboard whose input has
+// run out.
+var ErrNoInput = errors.New("no more input")
+
+// Device is a bank of memory-mapped registers. Errors abort the
+// instruction that accessed the register with an Exception.
+type Device interface {
+	Read(address uint16) (uint16, error)
+	Write(address, value uint16) error
+}
+
+// Map routes accesses to address to d instead of memory. Devices that
+// implement Interrupter may raise interrupts.
+func (m *Machine) Map(address uint16, d Device) {
+	m.devices[address] = d
+
+	// Rebuild the interrupt sources in address order, so that the
+	// lowest-addressed device wins ties between equal priorities
+	addresses := make([]int, 0, len(m.devices))
+	for addr := range m.devices {
+		addresses = append(addresses, int(addr))
+	}
+	sort.Ints(addresses)
+
+	m.interrupters = m.interrupters[:0]
+	seen := make(map[Device]bool)
+	for _, addr := range addresses {
+		dev := m.devices[uint16(addr)]
+		if seen[dev] {
+			continue
+		}
+		seen[dev] = true
+		if intr, ok := dev.(Interrupter); ok {
+			m.interrupters = append(m.interrupters, intr)
+		}
+	}
+}
+
+// AttachConsole maps a keyboard reading from in and a display writing to
+// out.
+func (m *Machine) AttachConsole(in io.Reader, out io.Writer) {
+	m.AttachKeyboardConsole(NewKeyboard(in), out)
+}
+
+// AttachKeyboardConsole is AttachConsole with a keyboard made by the
+// caller, such as one from NewAsyncKeyboard.
+func (m *Machine) AttachKeyboardConsole(kb *Keyboard, out io.Writer) {
+	m.Map(KBSR, kb)
+	m.Map(KBDR, kb)
+
+	display := NewDisplay(out)
+	m.Map(DSR, display)
+	m.Map(DDR, display)
+}
+
+// Keyboard backs KBSR and KBDR with an io.Reader. A character is read
+// when the program polls KBSR, or has enabled interrupts, and none is
+// pending, so scripted input is consumed exactly as the program asks for
+// it.
+type Keyboard struct {
+	r      io.Reader
+	keys   chan byte // Input read ahead by an asynchronous keyboard
+	err    error
+	status uint16
+	data   uint16
+}
+
+func NewKeyboard(r io.Reader) *Keyboard {
+	return &Keyboard{r: r}
+}
+
+// NewAsyncKeyboard returns a keyboard that reads r in the background, so
+// that waiting for a key never blocks the processor. Use it for terminals;
+// programs then spin or keep working until a key arrives, as on hardware.
+func NewAsyncKeyboard(r io.Reader) *Keyboard {
+	k := &Keyboard{keys: make(chan byte, 64)}
+	go func() {
+		var buf [1]byte
+		for {
+			if _, err := r.Read(buf[:]); err != nil {
+				close(k.keys)
+				return
+			}
+			k.keys <- buf[0]
+		}
+	}()
+	return k
+}
+
+func (k *Keyboard) Read(address uint16) (uint16, error) {
+	switch address {
+	case KBSR:
+		if k.status&statusReady == 0 {
+			if err := k.poll(); err != nil {
+				return k.status, err
+			}
+		}
+		return k.status, nil
+	case KBDR:
+		k.status &^= statusReady
+		return k.data, nil
+	}
+	return 0, nil
+}
+
+func (k *Keyboard) Write(address, value uint16) error {
+	if address == KBSR {
+		k.status = k.status&statusReady | value&interruptEnable
+	}
+	return nil
+}
+
+// Interrupt requests a keyboard interrupt while one is enabled and a
+// character is ready.
+func (k *Keyboard) Interrupt() (vector, priority uint16, ok bool) {
+	if k.status&interruptEnable == 0 {
+		return 0, 0, false
+	}
+	if k.status&statusReady == 0 && k.poll() != nil {
+		return 0, 0, false
+	}
+	return VectorKeyboard, 4, k.status&statusReady != 0
+}
+
+// poll reads the next character into KBDR if one is available.
+func (k *Keyboard) poll() error {
+	if k.keys != nil {
+		select {
+		case ch, ok := <-k.keys:
+			if !ok {
+				return ErrNoInput
+			}
+			k.data = uint16(ch)
+			k.status |= statusReady
+		default:
+		}
+		return nil
+	}
+
+	if k.r == nil || k.err != nil {
+		return ErrNoInput
+	}
+
+	var buf [1]byte
+	if _, err := io.ReadFull(k.r, buf[:]); err != nil {
+		if err == io.EOF {
+			err = ErrNoInput
+		}
+		k.err = err
+		return err
+	}
+
+	k.data = uint16(buf[0])
+	k.status |= statusReady
+	return nil
+}
+
+// Display backs DSR and DDR with an io.Writer. Output is written
+// synchronously, so the display is always ready.
+type Display struct {
+	w io.Writer
+}
+
+func NewDisplay(w io.Writer) *Display {
+	return &Display{w: w}
+}
+
+func (d *Display) Read(address uint16) (uint16, error) {
+	if address == DSR {
+		return statusReady, nil
+	}
+	return 0, nil
+}
+
+func (d *Display) Write(address, value uint16) error {
+	if address == DDR {
+		_, err := d.w.Write([]byte{byte(value)})
+		return err
+	}
+	return nil
+}
+
+// machineControl backs MCR. Clearing the clock enable bit halts the
+// machine.
+type machineControl struct {
+	m *Machine
+}
+
+func (mc machineControl) Read(address uint16) (uint16, error) {
+	if mc.m.halted {
+		return 0, nil
+	}
+	return clockEnable, nil
+}
+
+func (mc machineControl) Write(address, value uint16) error {
+	if value&clockEnable == 0 {
+		mc.m.halted = true
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+// Package vm runs LC-3 programs on a simulated machine with the operating
+// system in lc3os loaded.
+//
+// Privilege follows the second edition of the architecture. Interrupts and
+// exceptions switch to supervisor mode and the supervisor stack, and RTI
+// returns from them, raising a privilege mode violation in user mode.
+// TRAP does not: it saves the return address in R7 and jumps through the
+// trap vector table in the mode the program was already in, and the
+// service routines return with RET. Nothing stops a user program from
+// reading or writing operating system memory.
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"lc3asm-parser/assembler"
+	"lc3asm-parser/lc3os"
+)
+
+const MemorySize = 1 << 16
+
+// Condition codes, as stored in the low three bits of the PSR
+const (
+	FlagP uint16 = 1 << iota
+	FlagZ
+	FlagN
+)
+
+// Processor status register fields
+const (
+	psrUser     = 1 << 15
+	psrPriority = 7 << 8
+	psrCond     = 7
+)
+
+// Interrupt and exception vectors, offsets into the interrupt vector table
+const (
+	VectorPrivilege     = 0x00
+	VectorIllegalOpcode = 0x01
+	VectorKeyboard      = 0x80
+)
+
+// Interrupter is implemented by devices that can interrupt the processor.
+// Interrupt is consulted before every instruction.
+type Interrupter interface {
+	Interrupt() (vector, priority uint16, ok bool)
+}
+
+const (
+	opBR   = 0x0
+	opADD  = 0x1
+	opLD   = 0x2
+	opST   = 0x3
+	opJSR  = 0x4
+	opAND  = 0x5
+	opLDR  = 0x6
+	opSTR  = 0x7
+	opRTI  = 0x8
+	opNOT  = 0x9
+	opLDI  = 0xA
+	opSTI  = 0xB
+	opJMP  = 0xC
+	opRES  = 0xD
+	opLEA  = 0xE
+	opTRAP = 0xF
+)
+
+// ErrHalted is returned by Step once the machine has stopped.
+var ErrHalted = errors.New("machine halted")
+
+// Exception is returned when the machine cannot continue executing the
+// program, for example when the keyboard runs out of input. Illegal
+// opcodes and privilege violations are handled by the operating system.
+type Exception struct {
+	PC          uint16 // Address of the faulting instruction
+	Instruction uint16
+	Reason      string
+}
+
+func (e *Exception) Error() string {
+	return fmt.Sprintf("exception at x%04X (x%04X): %s", e.PC, e.Instruction, e.Reason)
+}
+
+// Access is a data read or write made by an instruction, an interrupt or
+// the trap mechanism. Instruction fetches are not reported.
+type Access struct {
+	Address uint16
+	Value   uint16 // The word read or written
+	Old     uint16 // Memory before a write; zero for devices
+	Write   bool
+	Device  bool // The access went to a device instead of memory
+}
+
+// Trace describes an instruction that completed, for OnTrace. Before is
+// taken ahead of any interrupt serviced on the way to the instruction.
+type Trace struct {
+	PC          uint16 // Address the instruction was fetched from
+	Instruction uint16
+	Interrupt   bool // An interrupt was serviced before the instruction
+	Exception   bool // The instruction raised an exception
+	Before      State
+	After       State
+	Writes      []Access // Only valid for the duration of the call
+}
+
+type Machine struct {
+	Memory    [MemorySize]uint16
+	Registers [8]uint16
+	PC        uint16
+	PSR       uint16 // Privilege (bit 15), priority (bits 10-8) and N, Z, P
+
+	// The inactive stack pointer is kept here while R6 holds the other
+	SavedSSP uint16
+	SavedUSP uint16
+
+	// OnAccess, when set, is called for every data access
+	OnAccess func(Access)
+
+	// OnTrace, when set, is called after every instruction that completes
+	OnTrace func(Trace)
+	writes  []Access // Made by the instruction being traced
+
+	devices      map[uint16]Device
+	interrupters []Interrupter
+	fault        error // Set by a device access that failed during Step
+	raised       bool  // Set by an exception raised during Step
+	halted       bool
+}
+
+// New returns a machine with the operating system loaded and a console
+// that has no input and discards its output; see AttachConsole.
+func New() *Machine {
+	m := &Machine{
+		PC:       0x3000,
+		PSR:      psrUser | FlagZ,
+		SavedSSP: lc3os.SupervisorStack,
+		devices:  make(map[uint16]Device),
+	}
+	m.Map(MCR, machineControl{m})
+	m.AttachConsole(nil, io.Discard)
+
+	image := lc3os.Image()
+	m.LoadImage(image.Origin, image.Code)
+	return m
+}
+
+// Load reads an .obj image, copies it into memory at its origin and points
+// the PC at the first word.
+func (m *Machine) Load(r io.Reader) error {
+	obj, err := assembler.ReadObject(r)
+	if err != nil {
+		return err
+	}
+
+	m.LoadImage(obj.Origin, obj.Code)
+	m.PC = obj.Origin
+	return nil
+}
+
+// LoadImage copies words into memory starting at origin.
+func (m *Machine) LoadImage(origin uint16, words []uint16) {
+	copy(m.Memory[origin:], words)
+}
+
+func (m *Machine) Halted() bool {
+	return m.halted
+}
+
+// State is the processor state kept outside memory.
+type State struct {
+	Registers          [8]uint16
+	PC, PSR            uint16
+	SavedSSP, SavedUSP uint16
+	Halted             bool
+}
+
+// State returns a snapshot of the processor state.
+func (m *Machine) State() State {
+	return State{
+		Registers: m.Registers,
+		PC:        m.PC,
+		PSR:       m.PSR,
+		SavedSSP:  m.SavedSSP,
+		SavedUSP:  m.SavedUSP,
+		Halted:    m.halted,
+	}
+}
+
+// Restore returns the processor to a snapshot taken by State. Memory and
+// devices are left alone.
+func (m *Machine) Restore(s State) {
+	m.Registers = s.Registers
+	m.PC = s.PC
+	m.PSR = s.PSR
+	m.SavedSSP = s.SavedSSP
+	m.SavedUSP = s.SavedUSP
+	m.halted = s.Halted
+}
+
+// Cond returns the condition codes, one of FlagN, FlagZ or FlagP.
+func (m *Machine) Cond() uint16 {
+	return m.PSR & psrCond
+}
+
+// Supervisor reports whether the processor is in supervisor mode.
+func (m *Machine) Supervisor() bool {
+	return m.PSR&psrUser == 0
+}
+
+// Priority returns the priority level of the running program.
+func (m *Machine) Priority() uint16 {
+	return (m.PSR & psrPriority) >> 8
+}
+
+// Run executes instructions until the machine halts or raises an exception.
+// A clean halt returns nil.
+func (m *Machine) Run() error {
+	for !m.halted {
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step executes a single instruction.
+func (m *Machine) Step() error {
+	if m.halted {
+		return ErrHalted
+	}
+
+	var before State
+	if m.OnTrace != nil {
+		before = m.State()
+		m.writes = m.writes[:0]
+	}
+
+	interrupted := m.checkInterrupts()
+	m.raised = false
+
+	pc := m.PC
+	instr := m.load(pc)
+	m.PC++
+
+	dr := (instr >> 9) & 7
+	sr1 := (instr >> 6) & 7
+
+	switch instr >> 12 {
+	case opBR:
+		if (instr>>9)&m.Cond() != 0 {
+			m.PC += signExtend(instr, 9)
+		}
+	case opADD, opAND:
+		var operand uint16
+		if instr&(1<<5) != 0 {
+			operand = signExtend(instr, 5)
+		} else {
+			operand = m.Registers[instr&7]
+		}
+		if instr>>12 == opADD {
+			m.setRegister(dr, m.Registers[sr1]+operand)
+		} else {
+			m.setRegister(dr, m.Registers[sr1]&operand)
+		}
+	case opNOT:
+		m.setRegister(dr, ^m.Registers[sr1])
+	case opLD:
+		m.setRegister(dr, m.read(m.PC+signExtend(instr, 9)))
+	case opLDI:
+		m.setRegister(dr, m.read(m.read(m.PC+signExtend(instr, 9))))
+	case opLDR:
+		m.setRegister(dr, m.read(m.Registers[sr1]+signExtend(instr, 6)))
+	case opLEA:
+		m.setRegister(dr, m.PC+signExtend(instr, 9))
+	case opST:
+		m.write(m.PC+signExtend(instr, 9), m.Registers[dr])
+	case opSTI:
+		m.write(m.read(m.PC+signExtend(instr, 9)), m.Registers[dr])
+	case opSTR:
+		m.write(m.Registers[sr1]+signExtend(instr, 6), m.Registers[dr])
+	case opJMP:
+		m.PC = m.Registers[sr1]
+	case opJSR:
+		target := m.Registers[sr1]
+		if instr&(1<<11) != 0 {
+			target = m.PC + signExtend(instr, 11)
+		}
+		m.Registers[7] = m.PC
+		m.PC = target
+	case opRTI:
+		if !m.Supervisor() {
+			m.exception(VectorPrivilege)
+			break
+		}
+		// Pop the PC and PSR pushed by the interrupted program
+		m.PC = m.pop()
+		m.PSR = m.pop()
+		if !m.Supervisor() {
+			m.SavedSSP = m.Registers[6]
+			m.Registers[6] = m.SavedUSP
+		}
+	case opTRAP:
+		// No change of mode or stack; see the package documentation
+		m.Registers[7] = m.PC
+		m.PC = m.read(lc3os.TrapTable + instr&0xFF)
+	case opRES:
+		m.exception(VectorIllegalOpcode)
+	}
+
+	if m.fault != nil {
+		err := m.fault
+		m.fault = nil
+		return &Exception{PC: pc, Instruction: instr, Reason: err.Error()}
+	}
+
+	if m.OnTrace != nil {
+		m.OnTrace(Trace{
+			PC:          pc,
+			Instruction: instr,
+			Interrupt:   interrupted,
+			Exception:   m.raised,
+			Before:      before,
+			After:       m.State(),
+			Writes:      m.writes,
+		})
+	}
+	return nil
+}
+
+// read loads a data word and reports the access.
+func (m *Machine) read(address uint16) uint16 {
+	value := m.load(address)
+	if m.OnAccess != nil {
+		_, device := m.devices[address]
+		m.OnAccess(Access{Address: address, Value: value, Device: device})
+	}
+	return value
+}
+
+// load reads a word from memory or from the device mapped at address.
+func (m *Machine) load(address uint16) uint16 {
+	if d, ok := m.devices[address]; ok {
+		value, err := d.Read(address)
+		if err != nil && m.fault == nil {
+			m.fault = err
+		}
+		return value
+	}
+	return m.Memory[address]
+}
+
+// write stores a word to memory or to the device mapped at address and
+// reports the access.
+func (m *Machine) write(address, value uint16) {
+	if d, ok := m.devices[address]; ok {
+		if err := d.Write(address, value); err != nil && m.fault == nil {
+			m.fault = err
+		}
+		m.report(Access{Address: address, Value: value, Write: true, Device: true})
+		return
+	}
+
+	m.report(Access{Address: address, Value: value, Old: m.Memory[address], Write: true})
+	m.Memory[address] = value
+}
+
+// report passes a write to the hooks that want it.
+func (m *Machine) report(a Access) {
+	if m.OnAccess != nil {
+		m.OnAccess(a)
+	}
+	if m.OnTrace != nil {
+		m.writes = append(m.writes, a)
+	}
+}
+
+// setRegister stores value in register r and updates the condition codes.
+func (m *Machine) setRegister(r, value uint16) {
+	m.Registers[r] = value
+	m.setCond(value)
+}
+
+func (m *Machine) setCond(value uint16) {
+	m.PSR &^= psrCond
+	switch {
+	case value == 0:
+		m.PSR |= FlagZ
+	case value&0x8000 != 0:
+		m.PSR |= FlagN
+	default:
+		m.PSR |= FlagP
+	}
+}
+
+// checkInterrupts services the first device requesting an interrupt at a
+// priority above the running program's and reports whether there was one.
+func (m *Machine) checkInterrupts() bool {
+	for _, dev := range m.interrupters {
+		vector, priority, ok := dev.Interrupt()
+		if ok && priority > m.Priority() {
+			m.enterSupervisor(vector, priority)
+			return true
+		}
+	}
+	return false
+}
+
+// exception starts the handler for vector at the current priority.
+func (m *Machine) exception(vector uint16) {
+	m.raised = true
+	m.enterSupervisor(vector, m.Priority())
+}
+
+// enterSupervisor switches to the supervisor stack, saves the PSR and PC
+// there and jumps through the interrupt vector table.
+func (m *Machine) enterSupervisor(vector, priority uint16) {
+	psr := m.PSR
+	if !m.Supervisor() {
+		m.SavedUSP = m.Registers[6]
+		m.Registers[6] = m.SavedSSP
+	}
+
+	m.PSR = priority<<8 | psr&psrCond
+	m.push(psr)
+	m.push(m.PC)
+	m.PC = m.read(lc3os.InterruptTable + vector)
+}
+
+func (m *Machine) push(value uint16) {
+	m.Registers[6]--
+	m.write(m.Registers[6], value)
+}
+
+func (m *Machine) pop() uint16 {
+	value := m.read(m.Registers[6])
+	m.Registers[6]++
+	return value
+}
+
+// signExtend sign extends the low n bits of value to 16 bits.
+func signExtend(value uint16, n int) uint16 {
+	value &= 1<<n - 1
+	if value&(1<<(n-1)) != 0 {
+		value |= 0xFFFF << n
+	}
+	return value
+}
@@ -0,0 +1,521 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"lc3asm-parser/assembler"
+)
+
+func TestArithmetic(t *testing.T) {
+	// HALT clobbers R0, R1 and R7, so results are kept in R2-R6
+	m, _ := run(t, `.ORIG x3000
+	AND R2,R2,#0
+	ADD R3,R2,#7
+	ADD R4,R3,#-10
+	ADD R5,R3,R4
+	AND R6,R3,#5
+	NOT R3,R3
+	HALT
+.END`, "")
+
+	expected := []uint16{0, 0xFFF8, 0xFFFD, 4, 5}
+	for i, value := range expected {
+		if m.Registers[i+2] != value {
+			t.Errorf("R%d wrong. expected=x%04X, got=x%04X", i+2, value, m.Registers[i+2])
+		}
+	}
+}
+
+func TestConditionCodes(t *testing.T) {
+	tests := []struct {
+		instruction string
+		expected    uint16
+	}{
+		{"AND R0,R0,#0", FlagZ},
+		{"ADD R0,R0,#-1", FlagN},
+		{"ADD R0,R0,#1", FlagP},
+		{"NOT R0,R0", FlagN},
+		{"LEA R0,#0", FlagP},
+	}
+
+	for i, tt := range tests {
+		m := load(t, ".ORIG x3000\n"+tt.instruction+"\n.END")
+		if err := m.Step(); err != nil {
+			t.Fatalf("tests[%d] - step failed: %s", i, err)
+		}
+		if m.Cond() != tt.expected {
+			t.Errorf("tests[%d] - cond wrong. expected=%03b, got=%03b", i, tt.expected, m.Cond())
+		}
+	}
+}
+
+func TestMemoryInstructions(t *testing.T) {
+	m, _ := run(t, `.ORIG x3000
+	LD R5, VALUE
+	LDI R6, POINTER
+	LEA R2, VALUE
+	LDR R3, R2, #1
+	ST R5, OUT1
+	STI R6, POINTER
+	STR R3, R2, #4
+	HALT
+VALUE	.FILL #42
+POINTER	.FILL TARGET
+TARGET	.FILL #-5
+OUT1	.BLKW 1
+OUT2	.BLKW 1
+.END`, "")
+
+	tests := []struct {
+		name     string
+		actual   uint16
+		expected uint16
+	}{
+		{"R5", m.Registers[5], 42},
+		{"R6", m.Registers[6], 0xFFFB},
+		{"R2", m.Registers[2], 0x3008},
+		{"R3", m.Registers[3], 0x300A},
+		{"OUT1", m.Memory[0x300B], 42},
+		{"TARGET", m.Memory[0x300A], 0xFFFB},
+		{"OUT2", m.Memory[0x300C], 0x300A},
+	}
+
+	for i, tt := range tests {
+		if tt.actual != tt.expected {
+			t.Errorf("tests[%d] - %s wrong. expected=x%04X, got=x%04X", i, tt.name, tt.expected, tt.actual)
+		}
+	}
+}
+
+func TestControlFlow(t *testing.T) {
+	m, _ := run(t, `.ORIG x3000
+	AND R5,R5,#0
+	ADD R1,R5,#5
+LOOP	ADD R5,R5,#2
+	ADD R1,R1,#-1
+	BRp LOOP
+	JSR DOUBLE
+	LEA R2, TRIPLE
+	JSRR R2
+	LEA R3, DONE
+	JMP R3
+	ADD R5,R5,#1 ; skipped
+DONE	HALT
+DOUBLE	ADD R5,R5,R5
+	RET
+TRIPLE	ADD R4,R5,R5
+	ADD R5,R4,R5
+	RET
+.END`, "")
+
+	if m.Registers[5] != 60 {
+		t.Errorf("R5 wrong. expected=60, got=%d", m.Registers[5])
+	}
+}
+
+func TestTraps(t *testing.T) {
+	_, out := run(t, `.ORIG x3000
+	LEA R0, HELLO
+	PUTS
+	GETC
+	OUT
+	IN
+	LEA R0, PACKED
+	PUTSP
+	HALT
+HELLO	.STRINGZ "Hi "
+PACKED	.FILL x6261
+	.FILL #99
+	.FILL #0
+.END`, "xy")
+
+	expected := "Hi xInput a character> y\nabc\n--- halting the LC-3 ---\n\n"
+	if out != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out)
+	}
+}
+
+func TestRTI(t *testing.T) {
+	m := load(t, `.ORIG x3000
+	LEA R6, STACK
+	RTI
+	HALT
+BACK	ADD R2,R2,#1
+	HALT
+STACK	.FILL BACK
+	.FILL #4
+.END`)
+
+	// Return from supervisor mode to supervisor mode, so R6 is not swapped
+	m.PSR = FlagZ
+	if err := m.Run(); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	if m.Registers[2] != 1 {
+		t.Errorf("RTI did not return to BACK")
+	}
+	if m.Registers[6] != 0x3007 {
+		t.Errorf("R6 wrong. expected=x3007, got=x%04X", m.Registers[6])
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{".ORIG x3000\nGETC", "no more input"},
+		{".ORIG x3000\nLDI R0, KBSR\nKBSR .FILL #-512", "exception at x3000 (xA000): no more input"},
+	}
+
+	for i, tt := range tests {
+		m := load(t, tt.input)
+		m.AttachConsole(strings.NewReader(""), io.Discard)
+		err := m.Run()
+
+		var exc *Exception
+		if !errors.As(err, &exc) {
+			t.Errorf("tests[%d] - expected *Exception, got=%v", i, err)
+			continue
+		}
+		if exc.Error() != tt.expected && exc.Reason != tt.expected {
+			t.Errorf("tests[%d] - exception wrong. expected=%q, got=%q", i, tt.expected, exc.Error())
+		}
+	}
+}
+
+func TestPrivilege(t *testing.T) {
+	m := load(t, ".ORIG x3000\nRTI\n.END")
+	if m.Supervisor() {
+		t.Fatalf("programs should start in user mode")
+	}
+
+	if err := m.Step(); err != nil {
+		t.Fatalf("step failed: %s", err)
+	}
+	if !m.Supervisor() {
+		t.Errorf("privilege violation did not enter supervisor mode")
+	}
+	if m.PC != m.Memory[0x0100] {
+		t.Errorf("PC wrong. expected=x%04X, got=x%04X", m.Memory[0x0100], m.PC)
+	}
+	if m.Registers[6] != 0x2FFE || m.Memory[0x2FFE] != 0x3001 || m.Memory[0x2FFF] != 0x8002 {
+		t.Errorf("supervisor stack wrong. R6=x%04X, stack=x%04X x%04X",
+			m.Registers[6], m.Memory[0x2FFE], m.Memory[0x2FFF])
+	}
+}
+
+func TestExceptionHandlers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"RTI", "\n--- privilege mode violation ---\n--- halting the LC-3 ---\n\n"},
+		{".FILL #-12288", "\n--- illegal opcode ---\n--- halting the LC-3 ---\n\n"},
+	}
+
+	for i, tt := range tests {
+		m, out := run(t, ".ORIG x3000\n"+tt.input+"\n.END", "")
+		if out != tt.expected {
+			t.Errorf("tests[%d] - output wrong. expected=%q, got=%q", i, tt.expected, out)
+		}
+		if !m.Halted() {
+			t.Errorf("tests[%d] - machine not halted", i)
+		}
+	}
+}
+
+func TestKeyboardInterrupt(t *testing.T) {
+	m, out := run(t, `.ORIG x3000
+	LD R6, USER_STACK
+	LD R1, HANDLER
+	STI R1, KBD_VECTOR
+	LD R1, ENABLE
+	STI R1, KBSR_ADDR
+; Count until the handler has stored a key
+WAIT	ADD R2, R2, #1
+	LD R3, KEY
+	BRz WAIT
+	HALT
+ISR	LDI R3, KBDR_ADDR
+	ST R3, KEY
+	ADD R4, R4, #1
+	AND R5, R5, #0
+	STI R5, KBSR_ADDR
+	RTI
+USER_STACK	.FILL #16384
+HANDLER	.FILL ISR
+KBD_VECTOR	.FILL #384
+ENABLE	.FILL #16384
+KBSR_ADDR	.FILL #-512
+KBDR_ADDR	.FILL #-510
+KEY	.FILL #0
+.END`, "k")
+
+	if out != "\n--- halting the LC-3 ---\n\n" {
+		t.Errorf("output wrong. got=%q", out)
+	}
+
+	tests := []struct {
+		name     string
+		actual   uint16
+		expected uint16
+	}{
+		{"KEY", m.Memory[0x3015], 'k'},
+		{"R4", m.Registers[4], 1},
+		{"R6", m.Registers[6], 0x4000},
+		{"Saved_SSP", m.SavedSSP, 0x3000},
+		{"saved PSR", m.Memory[0x2FFF] & 0x8000, 0x8000},
+	}
+
+	for i, tt := range tests {
+		if tt.actual != tt.expected {
+			t.Errorf("tests[%d] - %s wrong. expected=x%04X, got=x%04X", i, tt.name, tt.expected, tt.actual)
+		}
+	}
+	if m.Supervisor() {
+		t.Errorf("RTI did not return to user mode")
+	}
+}
+
+func TestInterruptPriority(t *testing.T) {
+	m := load(t, ".ORIG x3000\nADD R0,R0,#1\n.END")
+	m.AttachConsole(strings.NewReader("a"), io.Discard)
+	m.write(KBSR, interruptEnable)
+
+	// A keyboard interrupt at priority 4 must wait while the processor
+	// runs at priority 4 or above
+	m.PSR = 4<<8 | FlagZ
+	if err := m.Step(); err != nil {
+		t.Fatalf("step failed: %s", err)
+	}
+	if m.PC != 0x3001 {
+		t.Errorf("interrupt taken at priority 4. PC=x%04X", m.PC)
+	}
+
+	m.PC = 0x3000
+	m.PSR = 3<<8 | FlagZ
+	m.Registers[6] = 0x3000
+	m.Memory[0x0180] = 0x5000
+	if err := m.Step(); err != nil {
+		t.Fatalf("step failed: %s", err)
+	}
+	if m.Priority() != 4 || m.Memory[0x2FFF] != 3<<8|FlagZ {
+		t.Errorf("interrupt not taken. priority=%d, saved PSR=x%04X", m.Priority(), m.Memory[0x2FFF])
+	}
+}
+
+func TestUndefinedTrap(t *testing.T) {
+	m, out := run(t, ".ORIG x3000\nTRAP x30\n.END", "")
+
+	expected := "\n--- undefined trap executed ---\n--- halting the LC-3 ---\n\n"
+	if out != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out)
+	}
+	if !m.Halted() {
+		t.Errorf("machine not halted")
+	}
+}
+
+func TestPolledIO(t *testing.T) {
+	_, out := run(t, `.ORIG x3000
+; Echo characters in upper case until a newline
+POLL	LDI R1, KBSR_ADDR
+	BRzp POLL
+	LDI R0, KBDR_ADDR
+	ADD R2, R0, #-10
+	BRz STOP
+	ADD R0, R0, #-16
+	ADD R0, R0, #-16
+WAIT	LDI R1, DSR_ADDR
+	BRzp WAIT
+	STI R0, DDR_ADDR
+	BR POLL
+STOP	LDI R1, MCR_ADDR
+	LD R2, CLOCK_MASK
+	AND R1, R1, R2
+	STI R1, MCR_ADDR
+	ADD R0, R0, #1 ; never executed
+KBSR_ADDR	.FILL #-512
+KBDR_ADDR	.FILL #-510
+DSR_ADDR	.FILL #-508
+DDR_ADDR	.FILL #-506
+MCR_ADDR	.FILL #-2
+CLOCK_MASK	.FILL #32767
+.END`, "shout\nignored")
+
+	if out != "SHOUT" {
+		t.Errorf("output wrong. expected=%q, got=%q", "SHOUT", out)
+	}
+}
+
+func TestKeyboardStatus(t *testing.T) {
+	kb := NewKeyboard(strings.NewReader("a"))
+
+	tests := []struct {
+		address  uint16
+		expected uint16
+		err      error
+	}{
+		{KBSR, 0x8000, nil},
+		{KBSR, 0x8000, nil},
+		{KBDR, 'a', nil},
+		{KBSR, 0x0000, ErrNoInput},
+	}
+
+	for i, tt := range tests {
+		value, err := kb.Read(tt.address)
+		if value != tt.expected || err != tt.err {
+			t.Errorf("tests[%d] - read x%04X wrong. expected=x%04X %v, got=x%04X %v",
+				i, tt.address, tt.expected, tt.err, value, err)
+		}
+	}
+
+	kb.Write(KBSR, 0xFFFF)
+	if value, _ := kb.Read(KBDR); value != 'a' {
+		t.Errorf("KBDR changed by write to KBSR. got=x%04X", value)
+	}
+	if value, _ := kb.Read(KBSR); value != 0x4000 {
+		t.Errorf("interrupt enable not stored. expected=x4000, got=x%04X", value)
+	}
+}
+
+type recorder struct {
+	reads  []uint16
+	writes []uint16
+}
+
+func (r *recorder) Read(address uint16) (uint16, error) {
+	r.reads = append(r.reads, address)
+	return 7, nil
+}
+
+func (r *recorder) Write(address, value uint16) error {
+	r.writes = append(r.writes, address, value)
+	return nil
+}
+
+func TestMapDevice(t *testing.T) {
+	m := load(t, `.ORIG x3000
+	LD R0, PORT
+	ST R0, PORT
+	HALT
+PORT	.FILL #0
+.END`)
+
+	dev := &recorder{}
+	m.Map(0x3003, dev)
+	if err := m.Run(); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+
+	if len(dev.reads) != 1 || dev.reads[0] != 0x3003 {
+		t.Errorf("reads wrong. got=%04X", dev.reads)
+	}
+	if len(dev.writes) != 2 || dev.writes[0] != 0x3003 || dev.writes[1] != 7 {
+		t.Errorf("writes wrong. got=%04X", dev.writes)
+	}
+	if m.Memory[0x3003] != 0 {
+		t.Errorf("device write reached memory")
+	}
+}
+
+func TestAccessHook(t *testing.T) {
+	m := load(t, `.ORIG x3000
+	LDI R2, POINTER
+	STR R2, R2, #1
+	TRAP x30
+POINTER	.FILL VALUE
+VALUE	.FILL x3000
+.END`)
+
+	var accesses []Access
+	m.OnAccess = func(a Access) {
+		accesses = append(accesses, a)
+	}
+	for i := 0; i < 3; i++ {
+		if err := m.Step(); err != nil {
+			t.Fatalf("step failed: %s", err)
+		}
+	}
+
+	expected := []Access{
+		{Address: 0x3003, Value: 0x3004},
+		{Address: 0x3004, Value: 0x3000},
+		{Address: 0x3001, Value: 0x3000, Old: 0x7481, Write: true},
+		{Address: 0x0030, Value: m.Memory[0x0030]},
+	}
+
+	if len(accesses) != len(expected) {
+		t.Fatalf("wrong number of accesses. expected=%d, got=%d: %+v", len(expected), len(accesses), accesses)
+	}
+	for i, a := range expected {
+		if accesses[i] != a {
+			t.Errorf("accesses[%d] wrong. expected=%+v, got=%+v", i, a, accesses[i])
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	m := New()
+	if err := m.Load(bytes.NewReader([]byte{0x40, 0x00, 0x12, 0x34, 0xF0, 0x25})); err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+
+	if m.PC != 0x4000 || m.Memory[0x4000] != 0x1234 || m.Memory[0x4001] != 0xF025 {
+		t.Errorf("image not loaded. PC=x%04X, memory=x%04X x%04X", m.PC, m.Memory[0x4000], m.Memory[0x4001])
+	}
+
+	if err := m.Load(bytes.NewReader([]byte{0x30})); err == nil {
+		t.Errorf("expected error loading odd-length image")
+	}
+}
+
+func TestStepAfterHalt(t *testing.T) {
+	m, _ := run(t, ".ORIG x3000\nHALT\n.END", "")
+
+	if !m.Halted() {
+		t.Fatalf("machine not halted")
+	}
+	if err := m.Step(); err != ErrHalted {
+		t.Errorf("expected ErrHalted, got=%v", err)
+	}
+}
+
+// load assembles input and loads it into a fresh machine.
+func load(t *testing.T, input string) *Machine {
+	t.Helper()
+
+	obj, err := assembler.Assemble(input)
+	if err != nil {
+		t.Fatalf("assembly failed:\n%s", err)
+	}
+
+	var buf bytes.Buffer
+	obj.WriteTo(&buf)
+
+	m := New()
+	if err := m.Load(&buf); err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	return m
+}
+
+// run executes input to completion with the given keyboard input and
+// returns the machine and everything it printed.
+func run(t *testing.T, input string, keys string) (*Machine, string) {
+	t.Helper()
+
+	m := load(t, input)
+	var out bytes.Buffer
+	m.AttachConsole(strings.NewReader(keys), &out)
+
+	if err := m.Run(); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	return m, out.String()
+}